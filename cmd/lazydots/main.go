@@ -6,11 +6,18 @@ import (
 	"slices"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/anakafeel/LazyDots/internal/cli"
 	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/link"
 	"github.com/anakafeel/LazyDots/internal/tui"
 )
 
 func main() {
+	// Subcommands run without a TTY and exit with a status code
+	if len(os.Args) > 1 && cli.IsCommand(os.Args[1]) {
+		os.Exit(cli.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
+
 	// If config doesn't exist → first time setup (no splash)
 	if !config.Exists() {
 		runSetup()
@@ -22,6 +29,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if _, err := link.FromConfig(cfg); err != nil {
+		log.Fatalf("invalid config %s: %v", config.Path(), err)
+	}
 
 	// Pick banner color once for consistent branding
 	bannerColor := tui.PickBannerColor()
@@ -0,0 +1,179 @@
+// Package cli implements LazyDots' non-interactive subcommands.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/fs"
+	"github.com/anakafeel/LazyDots/internal/link"
+)
+
+// Exit codes returned by Run.
+const (
+	ExitOK      = 0 // success
+	ExitFailure = 1 // an operation failed, or status found unlinked files
+	ExitUsage   = 2 // bad arguments, unknown package or missing config
+)
+
+var errUsage = errors.New("usage error")
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(env *env, args []string) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"status", "status [pkg...]", "Show link status of packages (all by default)", runStatus},
+		{"link", "link <pkg>...", "Link every file in the given packages", runLink},
+		{"unlink", "unlink <pkg>...", "Unlink every file in the given packages", runUnlink},
+		{"restow", "restow <pkg>...", "Unlink and then relink the given packages", runRestow},
+		{"add", "add <pkg> <path>...", "Move files into a package and link them back", runAdd},
+		{"apply", "apply [--profile <name>]", "Link a profile's packages and unlink all others", runApply},
+		{"pull", "pull <pkg>...", "Copy modified targets of copied files back into the repo", runPull},
+		{"drift", "drift [--take|--restore] [pkg...]", "Find links replaced by edited files", runDrift},
+		{"undo", "undo [n]", "Revert the most recent operations (one by default)", runUndo},
+		{"redo", "redo [n]", "Apply the most recently undone operations again", runRedo},
+		{"doctor", "doctor [--fix]", "Find (and remove) broken symlinks into the repo", runDoctor},
+		{"help", "help", "Show this help", runHelp},
+	}
+}
+
+// IsCommand reports whether name is a known subcommand.
+func IsCommand(name string) bool {
+	return slices.ContainsFunc(commands, func(c command) bool { return c.name == name })
+}
+
+// env carries the output streams and resolved repository for a command.
+type env struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	dotfiles string // --dotfiles override
+	target   string // --target override
+	cfg      config.Config
+	engine   *link.Engine
+}
+
+// Run executes the subcommand in args[0] and returns the process exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	e := &env{stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		e.usage(stderr)
+		return ExitUsage
+	}
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(e, args[1:])
+		}
+	}
+	fmt.Fprintf(stderr, "lazydots: unknown command %q\n", args[0])
+	e.usage(stderr)
+	return ExitUsage
+}
+
+func (e *env) usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: lazydots [--no-splash] | lazydots <command> [--dotfiles <path>] [--target <dir>] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-20s %s\n", c.usage, c.summary)
+	}
+}
+
+func runHelp(e *env, _ []string) int {
+	e.usage(e.stdout)
+	return ExitOK
+}
+
+// flags returns a FlagSet with the options shared by every command.
+func (e *env) flags(name string) *flag.FlagSet {
+	fset := flag.NewFlagSet(name, flag.ContinueOnError)
+	fset.SetOutput(e.stderr)
+	fset.StringVar(&e.dotfiles, "dotfiles", "", "path to the dotfiles repository (overrides config)")
+	fset.StringVar(&e.target, "target", "", "directory to link every package into (overrides config)")
+	return fset
+}
+
+// setup loads the config (or uses the --dotfiles override), applies the
+// --target override and builds the link engine. Errors are reported to stderr.
+func (e *env) setup() error {
+	if dotfiles := e.dotfiles; dotfiles != "" {
+		abs, err := fs.ResolveAndValidateDirectory(dotfiles)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: invalid dotfiles path %q: %v\n", dotfiles, err)
+			return err
+		}
+		e.cfg = config.Config{DotfilesPath: abs}
+	} else {
+		if !config.Exists() {
+			fmt.Fprintf(e.stderr, "lazydots: no config at %s; run lazydots to set up or pass --dotfiles\n", config.Path())
+			return errUsage
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: failed to load config: %v\n", err)
+			return err
+		}
+		e.cfg = cfg
+	}
+
+	if e.target != "" {
+		// An explicit target wins over the config, per-package ones
+		// included. Unlike in the config, it may be relative.
+		target, err := fs.ResolvePath(e.target)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: invalid target %q: %v\n", e.target, err)
+			return err
+		}
+		e.cfg.Target = target
+		for name, pc := range e.cfg.Packages {
+			pc.Target = ""
+			e.cfg.Packages[name] = pc
+		}
+	}
+
+	engine, err := link.FromConfig(e.cfg)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "lazydots: config: %v\n", err)
+		return err
+	}
+	e.engine = engine
+	return nil
+}
+
+// packages resolves package names to packages in the repository. With no
+// names and all set, every package is returned.
+func (e *env) packages(names []string, all bool) ([]link.Package, error) {
+	pkgs, err := link.Packages(e.cfg.DotfilesPath)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "lazydots: failed to read dotfiles root: %v\n", err)
+		return nil, err
+	}
+	if len(names) == 0 {
+		if all {
+			return pkgs, nil
+		}
+		fmt.Fprintln(e.stderr, "lazydots: no package given")
+		return nil, errUsage
+	}
+
+	var selected []link.Package
+	for _, name := range names {
+		i := slices.IndexFunc(pkgs, func(p link.Package) bool { return p.Name == name })
+		if i == -1 {
+			fmt.Fprintf(e.stderr, "lazydots: unknown package %q\n", name)
+			return nil, errUsage
+		}
+		selected = append(selected, pkgs[i])
+	}
+	return selected, nil
+}
@@ -0,0 +1,519 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testEnv creates a dotfiles repo with a "bash" package and points $HOME
+// and $XDG_STATE_HOME at scratch directories for the duration of the test.
+func testEnv(t *testing.T) (root, home string) {
+	t.Helper()
+
+	tmpDir, err := os.MkdirTemp("", "lazydots-cli-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	root = filepath.Join(tmpDir, "dotfiles")
+	home = filepath.Join(tmpDir, "home")
+	for _, path := range []string{
+		filepath.Join(root, "bash", ".bashrc"),
+		filepath.Join(root, "bash", ".profile"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("# "+filepath.Base(path)), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.MkdirAll(home, 0o755); err != nil {
+		t.Fatalf("failed to create home: %v", err)
+	}
+	t.Setenv("HOME", home)
+	// Keep the journal, sync records and backups out of the real state dir.
+	t.Setenv("XDG_STATE_HOME", filepath.Join(tmpDir, "state"))
+	return root, home
+}
+
+func run(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "no args", args: nil, want: ExitUsage},
+		{name: "unknown command", args: []string{"frobnicate"}, want: ExitUsage},
+		{name: "help", args: []string{"help"}, want: ExitOK},
+		{name: "link without package", args: []string{"link", "--dotfiles", "."}, want: ExitUsage},
+		{name: "bad dotfiles path", args: []string{"status", "--dotfiles", "/this/path/does/not/exist"}, want: ExitUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _, _ := run(tt.args...); code != tt.want {
+				t.Errorf("Run(%v) = %d, want %d", tt.args, code, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunLinkLifecycle(t *testing.T) {
+	root, home := testEnv(t)
+
+	if code, _, _ := run("status", "--dotfiles", root); code != ExitFailure {
+		t.Errorf("status before link = %d, want %d", code, ExitFailure)
+	}
+
+	if code, _, stderr := run("link", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("link = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if _, err := os.Readlink(filepath.Join(home, ".bashrc")); err != nil {
+		t.Errorf("link did not create ~/.bashrc symlink: %v", err)
+	}
+
+	code, stdout, _ := run("status", "--dotfiles", root, "bash")
+	if code != ExitOK {
+		t.Errorf("status after link = %d, want %d", code, ExitOK)
+	}
+	if !strings.Contains(stdout, "linked") {
+		t.Errorf("status output missing linked entries:\n%s", stdout)
+	}
+
+	if code, _, stderr := run("restow", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Errorf("restow = %d, want %d: %s", code, ExitOK, stderr)
+	}
+
+	if code, _, stderr := run("unlink", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("unlink = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("unlink left ~/.bashrc in place")
+	}
+}
+
+func TestRunLinkConflict(t *testing.T) {
+	root, home := testEnv(t)
+
+	if err := os.WriteFile(filepath.Join(home, ".bashrc"), []byte("local"), 0o644); err != nil {
+		t.Fatalf("failed to write conflict: %v", err)
+	}
+
+	if code, _, _ := run("link", "--dotfiles", root, "bash"); code != ExitFailure {
+		t.Errorf("link with conflict = %d, want %d", code, ExitFailure)
+	}
+	if code, _, _ := run("link", "--dotfiles", root, "nope"); code != ExitUsage {
+		t.Errorf("link unknown package = %d, want %d", code, ExitUsage)
+	}
+}
+
+func TestRunStatusJSON(t *testing.T) {
+	root, home := testEnv(t)
+
+	if err := os.Symlink(filepath.Join(root, "bash", ".bashrc"), filepath.Join(home, ".bashrc")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".profile"), []byte("local"), 0o644); err != nil {
+		t.Fatalf("failed to write conflict: %v", err)
+	}
+
+	code, stdout, stderr := run("status", "--dotfiles", root, "--json")
+	if code != ExitFailure {
+		t.Errorf("status --json = %d, want %d: %s", code, ExitFailure, stderr)
+	}
+
+	var report statusReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("status --json printed invalid JSON: %v\n%s", err, stdout)
+	}
+	if report.DotfilesPath != root {
+		t.Errorf("dotfiles_path = %q, want %q", report.DotfilesPath, root)
+	}
+	if len(report.Packages) != 1 || report.Packages[0].Name != "bash" {
+		t.Fatalf("packages = %+v, want [bash]", report.Packages)
+	}
+
+	got := map[string]string{}
+	for _, f := range report.Packages[0].Files {
+		got[f.Rel] = f.Status.String()
+		if f.Rel == ".profile" && f.Reason == "" {
+			t.Errorf("conflict on .profile has no reason")
+		}
+		if f.Target != filepath.Join(home, f.Rel) {
+			t.Errorf("%s target = %q, want %q", f.Rel, f.Target, filepath.Join(home, f.Rel))
+		}
+	}
+	if got[".bashrc"] != "linked" || got[".profile"] != "conflict" {
+		t.Errorf("statuses = %v, want .bashrc linked and .profile conflict", got)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	root, home := testEnv(t)
+
+	code, stdout, stderr := run("link", "--dotfiles", root, "--dry-run", "bash")
+	if code != ExitOK {
+		t.Fatalf("link --dry-run = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if !strings.Contains(stdout, "symlink") || !strings.Contains(stdout, filepath.Join(home, ".bashrc")) {
+		t.Errorf("link --dry-run output missing planned symlink:\n%s", stdout)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("link --dry-run changed the target directory")
+	}
+
+	if err := os.WriteFile(filepath.Join(home, ".profile"), []byte("local"), 0o644); err != nil {
+		t.Fatalf("failed to write conflict: %v", err)
+	}
+	code, stdout, _ = run("link", "--dotfiles", root, "--dry-run", "bash")
+	if code != ExitFailure || !strings.Contains(stdout, "skip") {
+		t.Errorf("link --dry-run with conflict = %d, want %d and a skip:\n%s", code, ExitFailure, stdout)
+	}
+}
+
+func TestRunLinkRelative(t *testing.T) {
+	root, home := testEnv(t)
+
+	if code, _, _ := run("link", "--dotfiles", root, "--relative", "--absolute", "bash"); code != ExitUsage {
+		t.Errorf("link --relative --absolute = %d, want %d", code, ExitUsage)
+	}
+
+	if code, _, stderr := run("link", "--dotfiles", root, "--relative", "bash"); code != ExitOK {
+		t.Fatalf("link --relative = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	raw, err := os.Readlink(filepath.Join(home, ".bashrc"))
+	if err != nil || filepath.IsAbs(raw) {
+		t.Errorf("link --relative created %q (err %v), want a relative link", raw, err)
+	}
+	if code, _, _ := run("status", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Errorf("status after relative link = %d, want %d", code, ExitOK)
+	}
+}
+
+func TestRunTarget(t *testing.T) {
+	root, home := testEnv(t)
+	scratch := filepath.Join(filepath.Dir(home), "scratch")
+
+	if code, _, stderr := run("link", "--dotfiles", root, "--target", scratch, "bash"); code != ExitOK {
+		t.Fatalf("link --target = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if _, err := os.Readlink(filepath.Join(scratch, ".bashrc")); err != nil {
+		t.Errorf("link --target did not link into %s: %v", scratch, err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("link --target touched $HOME")
+	}
+	if code, _, _ := run("status", "--dotfiles", root, "--target", scratch); code != ExitOK {
+		t.Errorf("status --target = %d, want %d", code, ExitOK)
+	}
+}
+
+func TestRunAdd(t *testing.T) {
+	root, home := testEnv(t)
+
+	conf := filepath.Join(home, ".config", "foo", "bar.conf")
+	if err := os.MkdirAll(filepath.Dir(conf), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(conf, []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", conf, err)
+	}
+
+	if code, _, _ := run("add", "--dotfiles", root, "foo"); code != ExitUsage {
+		t.Errorf("add without path = %d, want %d", code, ExitUsage)
+	}
+	if code, _, _ := run("add", "--dotfiles", root, "../foo", conf); code != ExitUsage {
+		t.Errorf("add with bad package name = %d, want %d", code, ExitUsage)
+	}
+
+	code, stdout, stderr := run("add", "--dotfiles", root, "foo", "~/.config/foo")
+	if code != ExitOK {
+		t.Fatalf("add = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if !strings.Contains(stdout, filepath.Join(".config", "foo", "bar.conf")) {
+		t.Errorf("add output missing added file:\n%s", stdout)
+	}
+	info, err := os.Stat(filepath.Join(root, "foo", ".config", "foo", "bar.conf"))
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("add did not move bar.conf into the package with its mode: %v (err %v)", info, err)
+	}
+	if code, _, _ := run("status", "--dotfiles", root, "foo"); code != ExitOK {
+		t.Errorf("status after add = %d, want %d", code, ExitOK)
+	}
+
+	if code, _, _ := run("add", "--dotfiles", root, "foo", "~/.config/foo"); code != ExitFailure {
+		t.Errorf("add of a linked path = %d, want %d", code, ExitFailure)
+	}
+}
+
+func TestRunDoctor(t *testing.T) {
+	root, home := testEnv(t)
+	if code, _, stderr := run("link", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("link = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if code, _, _ := run("doctor", "--dotfiles", root); code != ExitOK {
+		t.Errorf("doctor on a healthy tree = %d, want %d", code, ExitOK)
+	}
+
+	// Renaming a file in the repository leaves its old link dangling.
+	if err := os.Rename(filepath.Join(root, "bash", ".profile"), filepath.Join(root, "bash", ".bash_profile")); err != nil {
+		t.Fatalf("failed to rename: %v", err)
+	}
+	code, stdout, _ := run("doctor", "--dotfiles", root)
+	if code != ExitFailure || !strings.Contains(stdout, "broken") || !strings.Contains(stdout, filepath.Join(home, ".profile")) {
+		t.Errorf("doctor = %d, want %d listing the broken link:\n%s", code, ExitFailure, stdout)
+	}
+
+	if code, _, stderr := run("doctor", "--dotfiles", root, "--fix"); code != ExitOK {
+		t.Fatalf("doctor --fix = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".profile")); !os.IsNotExist(err) {
+		t.Errorf("doctor --fix left the broken link behind")
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".bashrc")); err != nil {
+		t.Errorf("doctor --fix removed a healthy link: %v", err)
+	}
+	if code, _, _ := run("doctor", "--dotfiles", root); code != ExitOK {
+		t.Errorf("doctor after --fix = %d, want %d", code, ExitOK)
+	}
+}
+
+func TestRunStatusOverlaps(t *testing.T) {
+	root, _ := testEnv(t)
+	work := filepath.Join(root, "bash-work", ".bashrc")
+	if err := os.MkdirAll(filepath.Dir(work), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(work, []byte("# work"), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", work, err)
+	}
+
+	if code, _, stderr := run("link", "--dotfiles", root, "bash-work"); code != ExitOK {
+		t.Fatalf("link bash-work = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	code, _, stderr := run("link", "--dotfiles", root, "bash")
+	if code != ExitFailure || !strings.Contains(stderr, "package bash-work") {
+		t.Errorf("link bash = %d, want %d naming the owning package:\n%s", code, ExitFailure, stderr)
+	}
+
+	_, stdout, _ := run("status", "--dotfiles", root, "--json", "bash")
+	var report statusReport
+	if err := json.Unmarshal([]byte(stdout), &report); err != nil {
+		t.Fatalf("status --json printed invalid JSON: %v\n%s", err, stdout)
+	}
+	if got := report.Packages[0].Overlaps; len(got) != 1 || got[0] != "bash-work" {
+		t.Errorf("overlaps of bash = %v, want [bash-work]", got)
+	}
+}
+
+func TestRunLinkRequires(t *testing.T) {
+	root, home := testEnv(t)
+	for path, content := range map[string]string{
+		filepath.Join(root, "git", ".gitconfig"):             "[user]",
+		filepath.Join(root, "git", "lazydots.json"):          `{"requires": ["bash"]}`,
+		filepath.Join(root, "bash-minimal", ".bashrc"):       "# minimal",
+		filepath.Join(root, "bash-minimal", "lazydots.json"): `{"conflicts": ["bash"]}`,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	code, stdout, stderr := run("link", "--dotfiles", root, "git")
+	if code != ExitOK {
+		t.Fatalf("link git = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if !strings.Contains(stdout, "bash, git: link") {
+		t.Errorf("link git did not link its requirement bash:\n%s", stdout)
+	}
+	if _, err := os.Readlink(filepath.Join(home, ".bashrc")); err != nil {
+		t.Errorf("link git did not link .bashrc: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(home, "lazydots.json")); !os.IsNotExist(err) {
+		t.Errorf("link git linked the manifest")
+	}
+
+	code, _, stderr = run("link", "--dotfiles", root, "bash-minimal")
+	if code != ExitFailure || !strings.Contains(stderr, "conflicts with bash") {
+		t.Errorf("link bash-minimal = %d, want %d with a conflict: %s", code, ExitFailure, stderr)
+	}
+}
+
+func TestRunLinkAllOrNothing(t *testing.T) {
+	root, home := testEnv(t)
+	for path, content := range map[string]string{
+		filepath.Join(root, "git", ".gitconfig"):    "[user]",
+		filepath.Join(root, "git", "lazydots.json"): `{"requires": ["bash"]}`,
+		filepath.Join(home, ".gitconfig"):           "# in the way",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+
+	for _, args := range [][]string{{"git"}, {"bash", "git"}} {
+		code, _, stderr := run(append([]string{"link", "--dotfiles", root}, args...)...)
+		if code != ExitFailure || !strings.Contains(stderr, "nothing was changed") {
+			t.Errorf("link %v = %d, want %d refusing the conflict: %s", args, code, ExitFailure, stderr)
+		}
+		if _, err := os.Lstat(filepath.Join(home, ".bashrc")); !os.IsNotExist(err) {
+			t.Fatalf("link %v linked bash although git was refused", args)
+		}
+	}
+}
+
+func TestRunApply(t *testing.T) {
+	root, home := testEnv(t)
+	tmux := filepath.Join(root, "tmux", ".tmux.conf")
+	if err := os.MkdirAll(filepath.Dir(tmux), 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(tmux, []byte("# tmux"), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", tmux, err)
+	}
+
+	cfg := `{"dotfiles_path": "` + root + `", "profiles": {
+		"server": {"packages": ["tmux"], "hosts": ["*"]},
+		"work": {"packages": ["bash", "tmux"]}
+	}}`
+	cfgPath := filepath.Join(home, ".config", "lazydots", "config.json")
+	if err := os.MkdirAll(filepath.Dir(cfgPath), 0o755); err != nil {
+		t.Fatalf("failed to create config dir: %v", err)
+	}
+	if err := os.WriteFile(cfgPath, []byte(cfg), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if code, _, _ := run("apply", "--profile", "nope"); code != ExitUsage {
+		t.Errorf("apply of an unknown profile = %d, want %d", code, ExitUsage)
+	}
+
+	if code, _, stderr := run("apply", "--profile", "work"); code != ExitOK {
+		t.Fatalf("apply --profile work = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	for _, name := range []string{".bashrc", ".profile", ".tmux.conf"} {
+		if _, err := os.Readlink(filepath.Join(home, name)); err != nil {
+			t.Errorf("apply --profile work did not link %s: %v", name, err)
+		}
+	}
+
+	// Without --profile the host picks "server", which drops bash.
+	code, stdout, stderr := run("apply")
+	if code != ExitOK {
+		t.Fatalf("apply = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if !strings.HasPrefix(stdout, "server:") {
+		t.Errorf("apply chose the wrong profile:\n%s", stdout)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".bashrc")); !os.IsNotExist(err) {
+		t.Errorf("apply did not unlink .bashrc, which is outside the profile")
+	}
+	if _, err := os.Readlink(filepath.Join(home, ".tmux.conf")); err != nil {
+		t.Errorf("apply unlinked .tmux.conf: %v", err)
+	}
+}
+
+func TestRunPull(t *testing.T) {
+	root, home := testEnv(t)
+	manifest := filepath.Join(root, "bash", "lazydots.json")
+	if err := os.WriteFile(manifest, []byte(`{"copy": [".bashrc"]}`), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", manifest, err)
+	}
+	if code, _, stderr := run("link", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("link = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	target := filepath.Join(home, ".bashrc")
+	if info, err := os.Lstat(target); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("link did not copy .bashrc: %v", err)
+	}
+
+	if err := os.WriteFile(target, []byte("# edited"), 0o644); err != nil {
+		t.Fatalf("failed to edit %s: %v", target, err)
+	}
+	code, stdout, stderr := run("pull", "--dotfiles", root, "bash")
+	if code != ExitOK || !strings.Contains(stdout, "pulled .bashrc") {
+		t.Fatalf("pull = %d, want %d pulling .bashrc:\n%s%s", code, ExitOK, stdout, stderr)
+	}
+	if got, _ := os.ReadFile(filepath.Join(root, "bash", ".bashrc")); string(got) != "# edited" {
+		t.Errorf("repo .bashrc after pull = %q, want the edited copy", got)
+	}
+	if code, _, _ := run("status", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Errorf("status after pull = %d, want %d", code, ExitOK)
+	}
+}
+
+func TestRunDrift(t *testing.T) {
+	root, home := testEnv(t)
+	if code, _, stderr := run("link", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("link = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if code, _, _ := run("drift", "--dotfiles", root); code != ExitOK {
+		t.Errorf("drift with every link intact = %d, want %d", code, ExitOK)
+	}
+
+	target := filepath.Join(home, ".bashrc")
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("# saved by an editor"), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", target, err)
+	}
+	code, stdout, _ := run("drift", "--dotfiles", root)
+	if code != ExitFailure || !strings.Contains(stdout, "drift .bashrc") || !strings.Contains(stdout, "+# saved by an editor") {
+		t.Errorf("drift = %d, want %d with a diff:\n%s", code, ExitFailure, stdout)
+	}
+
+	if code, _, stderr := run("drift", "--dotfiles", root, "--restore"); code != ExitOK {
+		t.Fatalf("drift --restore = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if dest, err := os.Readlink(target); err != nil || dest != filepath.Join(root, "bash", ".bashrc") {
+		t.Errorf("drift --restore left %s -> %q, %v", target, dest, err)
+	}
+}
+
+func TestRunUndo(t *testing.T) {
+	root, home := testEnv(t)
+	if code, stdout, _ := run("undo", "--dotfiles", root); code != ExitOK || !strings.Contains(stdout, "Nothing to undo") {
+		t.Errorf("undo with an empty journal = %d: %s", code, stdout)
+	}
+	if code, _, stderr := run("link", "--dotfiles", root, "bash"); code != ExitOK {
+		t.Fatalf("link = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	target := filepath.Join(home, ".bashrc")
+
+	code, stdout, stderr := run("undo", "--dotfiles", root)
+	if code != ExitOK || !strings.Contains(stdout, "undid link") {
+		t.Fatalf("undo = %d, want %d undoing the link:\n%s%s", code, ExitOK, stdout, stderr)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("undo left %s: %v", target, err)
+	}
+
+	if code, _, stderr := run("redo", "--dotfiles", root); code != ExitOK {
+		t.Fatalf("redo = %d, want %d: %s", code, ExitOK, stderr)
+	}
+	if dest, err := os.Readlink(target); err != nil || dest != filepath.Join(root, "bash", ".bashrc") {
+		t.Errorf("redo left %s -> %q, %v", target, dest, err)
+	}
+	if code, _, _ := run("undo", "--dotfiles", root, "zero"); code != ExitUsage {
+		t.Errorf("undo zero = %d, want %d", code, ExitUsage)
+	}
+}
@@ -0,0 +1,498 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anakafeel/LazyDots/internal/fs"
+	"github.com/anakafeel/LazyDots/internal/git"
+	"github.com/anakafeel/LazyDots/internal/link"
+)
+
+// parse parses fset, sets up the engine and resolves the package arguments.
+// It returns a non-zero exit code if anything went wrong.
+func (e *env) parse(fset *flag.FlagSet, args []string, all bool) ([]link.Package, int) {
+	if err := fset.Parse(args); err != nil {
+		return nil, ExitUsage
+	}
+	if err := e.setup(); err != nil {
+		return nil, ExitUsage
+	}
+	pkgs, err := e.packages(fset.Args(), all)
+	if err != nil {
+		return nil, ExitUsage
+	}
+	return pkgs, ExitOK
+}
+
+// statusReport is the JSON document printed by `status --json`.
+type statusReport struct {
+	DotfilesPath string          `json:"dotfiles_path"`
+	Packages     []packageReport `json:"packages"`
+}
+
+type packageReport struct {
+	link.Package
+	Files    []link.Entry `json:"files"`
+	Overlaps []string     `json:"overlaps,omitempty"` // packages claiming some of the same targets
+	Error    string       `json:"error,omitempty"`
+}
+
+func runStatus(e *env, args []string) int {
+	fset := e.flags("status")
+	asJSON := fset.Bool("json", false, "print machine-readable JSON")
+	pkgs, code := e.parse(fset, args, true)
+	if code != ExitOK {
+		return code
+	}
+
+	// Overlaps are looked for across the whole repository.
+	var overlaps map[string][]string
+	if owners, err := e.engine.Owners(); err == nil {
+		overlaps = owners.Overlaps()
+	}
+
+	report := statusReport{DotfilesPath: e.cfg.DotfilesPath, Packages: []packageReport{}}
+	for _, pkg := range pkgs {
+		pr := packageReport{Package: pkg, Files: []link.Entry{}, Overlaps: overlaps[pkg.Name]}
+		entries, err := e.engine.Scan(pkg.Path)
+		if err != nil {
+			pr.Error = err.Error()
+			code = ExitFailure
+		} else {
+			pr.Files = entries
+		}
+		for _, entry := range pr.Files {
+			if entry.Status != link.StatusLinked {
+				code = ExitFailure
+			}
+		}
+		report.Packages = append(report.Packages, pr)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(e.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: failed to encode status: %v\n", err)
+			return ExitFailure
+		}
+		return code
+	}
+
+	for _, pr := range report.Packages {
+		if pr.Error != "" {
+			fmt.Fprintf(e.stderr, "lazydots: failed to scan %s: %s\n", pr.Name, pr.Error)
+			continue
+		}
+		if len(pr.Overlaps) > 0 {
+			fmt.Fprintf(e.stdout, "%s (shares targets with %s)\n", pr.Name, strings.Join(pr.Overlaps, ", "))
+		} else {
+			fmt.Fprintln(e.stdout, pr.Name)
+		}
+		for _, entry := range pr.Files {
+			line := fmt.Sprintf("  %-9s %s -> %s", entry.Status, entry.Rel, entry.Target)
+			if entry.Reason != "" {
+				line += " (" + entry.Reason + ")"
+			}
+			fmt.Fprintln(e.stdout, line)
+		}
+	}
+	return code
+}
+
+func runLink(e *env, args []string) int {
+	return e.batch("link", args, func(entries []link.Entry) link.Plan {
+		return e.engine.PlanLink(entries)
+	})
+}
+
+func runUnlink(e *env, args []string) int {
+	return e.batch("unlink", args, func(entries []link.Entry) link.Plan {
+		return e.engine.PlanUnlink(entries)
+	})
+}
+
+func runRestow(e *env, args []string) int {
+	return e.batch("restow", args, func(entries []link.Entry) link.Plan {
+		return e.engine.PlanRestow(entries)
+	})
+}
+
+func runAdd(e *env, args []string) int {
+	fset := e.flags("add")
+	if err := fset.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fset.NArg() < 2 {
+		fmt.Fprintln(e.stderr, "lazydots: add needs a package and at least one path")
+		return ExitUsage
+	}
+	name := fset.Arg(0)
+	if name == "." || name == ".." || name == ".git" || strings.ContainsRune(name, filepath.Separator) {
+		fmt.Fprintf(e.stderr, "lazydots: invalid package name %q\n", name)
+		return ExitUsage
+	}
+	if err := e.setup(); err != nil {
+		return ExitUsage
+	}
+
+	// The package is created if it doesn't exist yet.
+	pkgPath := filepath.Join(e.cfg.DotfilesPath, name)
+	code := ExitOK
+	for _, arg := range fset.Args()[1:] {
+		path, err := fs.ResolvePath(arg)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: invalid path %q: %v\n", arg, err)
+			code = ExitFailure
+			continue
+		}
+		entries, err := e.engine.Add(pkgPath, path)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", name, err)
+			code = ExitFailure
+			continue
+		}
+		for _, entry := range entries {
+			fmt.Fprintf(e.stdout, "%s: added %s -> %s\n", name, entry.Rel, entry.Target)
+		}
+	}
+	return code
+}
+
+func runApply(e *env, args []string) int {
+	fset := e.flags("apply")
+	profile := fset.String("profile", "", "profile to apply (default: the config's, or the one matching this host)")
+	dryRun := fset.Bool("dry-run", false, "print the planned changes without applying them")
+	if err := fset.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fset.NArg() > 0 {
+		fmt.Fprintln(e.stderr, "lazydots: apply takes no arguments; use --profile")
+		return ExitUsage
+	}
+	if err := e.setup(); err != nil {
+		return ExitUsage
+	}
+
+	name := *profile
+	if name == "" {
+		hostname, _ := os.Hostname()
+		if name = e.cfg.ActiveProfile(hostname); name == "" {
+			fmt.Fprintf(e.stderr, "lazydots: no profile given and none matches host %q\n", hostname)
+			return ExitUsage
+		}
+	}
+	p, ok := e.cfg.Profiles[name]
+	if !ok {
+		fmt.Fprintf(e.stderr, "lazydots: unknown profile %q\n", name)
+		return ExitUsage
+	}
+
+	plan, pkgs, err := e.engine.PlanProfile(p.Packages)
+	if err != nil {
+		fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", name, err)
+		return ExitFailure
+	}
+	var names []string
+	for _, pkg := range pkgs {
+		names = append(names, pkg.Name)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(e.stdout, "%s: apply plan (%s)\n", name, strings.Join(names, ", "))
+		for _, line := range strings.SplitAfter(plan.String(), "\n") {
+			if line != "" {
+				fmt.Fprint(e.stdout, "  "+line)
+			}
+		}
+		if plan.Conflicts() > 0 {
+			return ExitFailure
+		}
+		return ExitOK
+	}
+
+	res := e.engine.Apply(plan)
+	for _, err := range res.Errors {
+		fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", name, err)
+	}
+	if res.RolledBack {
+		fmt.Fprintf(e.stderr, "lazydots: %s: apply failed, all changes were rolled back\n", name)
+	} else if len(res.Errors) > 0 {
+		fmt.Fprintf(e.stderr, "lazydots: %s: apply refused because of conflicts, nothing was changed\n", name)
+	}
+	fmt.Fprintf(e.stdout, "%s: applied %s, %d files changed, %d errors\n", name, strings.Join(names, ", "), res.Done, len(res.Errors))
+	if len(res.Errors) > 0 {
+		return ExitFailure
+	}
+	return ExitOK
+}
+
+func runPull(e *env, args []string) int {
+	fset := e.flags("pull")
+	pkgs, code := e.parse(fset, args, false)
+	if code != ExitOK {
+		return code
+	}
+
+	for _, pkg := range pkgs {
+		entries, err := e.engine.Scan(pkg.Path)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: failed to scan %s: %v\n", pkg.Name, err)
+			code = ExitFailure
+			continue
+		}
+		pulled := 0
+		for _, entry := range entries {
+			if (!entry.Copy && !entry.Secret) || entry.Conflict != link.ConflictDrift {
+				continue
+			}
+			b, err := e.engine.Pull(entry)
+			if err != nil {
+				fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", pkg.Name, err)
+				code = ExitFailure
+				continue
+			}
+			fmt.Fprintf(e.stdout, "%s: pulled %s (previous version kept at %s)\n", pkg.Name, entry.Rel, b.Path)
+			pulled++
+		}
+		fmt.Fprintf(e.stdout, "%s: pulled %d\n", pkg.Name, pulled)
+	}
+	return code
+}
+
+func runDrift(e *env, args []string) int {
+	fset := e.flags("drift")
+	take := fset.Bool("take", false, "take the home versions into the repo and restore the links")
+	restore := fset.Bool("restore", false, "restore the links, keeping the home versions in the backup store")
+	pkgs, code := e.parse(fset, args, true)
+	if code != ExitOK {
+		return code
+	}
+	if *take && *restore {
+		fmt.Fprintln(e.stderr, "lazydots: --take and --restore are mutually exclusive")
+		return ExitUsage
+	}
+
+	found := 0
+	for _, pkg := range pkgs {
+		entries, err := e.engine.Scan(pkg.Path)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: failed to scan %s: %v\n", pkg.Name, err)
+			code = ExitFailure
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Conflict != link.ConflictDrift || entry.Generated() {
+				continue
+			}
+			found++
+			switch {
+			case *take:
+				if _, err := e.engine.Resolve(entry, link.ResolveAdopt); err != nil {
+					fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", pkg.Name, err)
+					code = ExitFailure
+					continue
+				}
+				fmt.Fprintf(e.stdout, "%s: took %s into the repo and restored its link\n", pkg.Name, entry.Target)
+			case *restore:
+				b, err := e.engine.Resolve(entry, link.ResolveOverwrite)
+				if err != nil {
+					fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", pkg.Name, err)
+					code = ExitFailure
+					continue
+				}
+				fmt.Fprintf(e.stdout, "%s: restored link %s (home version kept at %s)\n", pkg.Name, entry.Target, b.Path)
+			default:
+				fmt.Fprintf(e.stdout, "%s: drift %s -> %s (%s)\n", pkg.Name, entry.Rel, entry.Target, entry.Reason)
+				if diff, err := git.DiffFiles(entry.Source, entry.Target); err == nil {
+					fmt.Fprint(e.stdout, diff)
+				}
+				code = ExitFailure
+			}
+		}
+	}
+	if found == 0 {
+		fmt.Fprintln(e.stdout, "No links replaced by files found")
+	}
+	return code
+}
+
+func runUndo(e *env, args []string) int {
+	return e.history("undo", args, (*link.Engine).Undo)
+}
+
+func runRedo(e *env, args []string) int {
+	return e.history("redo", args, (*link.Engine).Redo)
+}
+
+// history reverts (or applies again) the last n journaled operations with
+// step, stopping at the first one that can't be.
+func (e *env) history(name string, args []string, step func(*link.Engine) (link.JournalEntry, error)) int {
+	fset := e.flags(name)
+	if err := fset.Parse(args); err != nil {
+		return ExitUsage
+	}
+	n := 1
+	switch fset.NArg() {
+	case 0:
+	case 1:
+		var err error
+		if n, err = strconv.Atoi(fset.Arg(0)); err != nil || n < 1 {
+			fmt.Fprintf(e.stderr, "lazydots: invalid count %q\n", fset.Arg(0))
+			return ExitUsage
+		}
+	default:
+		fmt.Fprintf(e.stderr, "lazydots: %s takes at most one argument\n", name)
+		return ExitUsage
+	}
+	if err := e.setup(); err != nil {
+		return ExitUsage
+	}
+
+	for i := 0; i < n; i++ {
+		op, err := step(e.engine)
+		if errors.Is(err, link.ErrNothingToUndo) || errors.Is(err, link.ErrNothingToRedo) {
+			if i == 0 {
+				fmt.Fprintf(e.stdout, "Nothing to %s\n", name)
+			}
+			return ExitOK
+		}
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: %s of %s failed: %v\n", name, op.Op, err)
+			return ExitFailure
+		}
+		fmt.Fprintf(e.stdout, "%s %s\n", pastTense[name], op)
+	}
+	return ExitOK
+}
+
+var pastTense = map[string]string{"undo": "undid", "redo": "redid"}
+
+func runDoctor(e *env, args []string) int {
+	fset := e.flags("doctor")
+	fix := fset.Bool("fix", false, "remove the symlinks that were found")
+	if err := fset.Parse(args); err != nil {
+		return ExitUsage
+	}
+	if fset.NArg() > 0 {
+		fmt.Fprintln(e.stderr, "lazydots: doctor takes no arguments")
+		return ExitUsage
+	}
+	if err := e.setup(); err != nil {
+		return ExitUsage
+	}
+
+	orphans, err := e.engine.Doctor()
+	if err != nil {
+		fmt.Fprintf(e.stderr, "lazydots: doctor failed: %v\n", err)
+		return ExitFailure
+	}
+
+	code := ExitOK
+	for _, o := range orphans {
+		if !*fix {
+			fmt.Fprintf(e.stdout, "%-9s %s -> %s\n", o.Kind, o.Path, o.Dest)
+			code = ExitFailure
+			continue
+		}
+		if err := e.engine.Prune(o); err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: %v\n", err)
+			code = ExitFailure
+			continue
+		}
+		fmt.Fprintf(e.stdout, "removed   %s -> %s\n", o.Path, o.Dest)
+	}
+	if len(orphans) == 0 {
+		fmt.Fprintln(e.stdout, "No broken or orphaned symlinks found")
+	}
+	return code
+}
+
+// batch plans op over every file of the named packages and applies it as
+// a single transaction, or just prints the plan with --dry-run.
+func (e *env) batch(name string, args []string, op func([]link.Entry) link.Plan) int {
+	fset := e.flags(name)
+	dryRun := fset.Bool("dry-run", false, "print the planned changes without applying them")
+	var relative, absolute *bool
+	if name != "unlink" {
+		relative = fset.Bool("relative", false, "create relative symlinks (overrides config)")
+		absolute = fset.Bool("absolute", false, "create absolute symlinks (overrides config)")
+	}
+	pkgs, code := e.parse(fset, args, false)
+	if code != ExitOK {
+		return code
+	}
+	if relative != nil && *relative && *absolute {
+		fmt.Fprintln(e.stderr, "lazydots: --relative and --absolute are mutually exclusive")
+		return ExitUsage
+	}
+	if name != "unlink" {
+		// Linking pulls in requirements and refuses conflicting packages.
+		var names []string
+		for _, pkg := range pkgs {
+			names = append(names, pkg.Name)
+		}
+		var err error
+		if pkgs, err = e.engine.PackagesToLink(names); err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: %v\n", err)
+			return ExitFailure
+		}
+	}
+
+	// Every package is planned and applied as one transaction, so
+	// requirements are never left linked when the package itself is refused.
+	var entries []link.Entry
+	var names []string
+	for _, pkg := range pkgs {
+		pe, err := e.engine.Scan(pkg.Path)
+		if err != nil {
+			fmt.Fprintf(e.stderr, "lazydots: failed to scan %s: %v\n", pkg.Name, err)
+			return ExitFailure
+		}
+		entries = append(entries, pe...)
+		names = append(names, pkg.Name)
+	}
+	label := strings.Join(names, ", ")
+	plan := op(entries)
+	switch {
+	case relative != nil && *relative:
+		plan = plan.WithRelative(true)
+	case absolute != nil && *absolute:
+		plan = plan.WithRelative(false)
+	}
+
+	if *dryRun {
+		fmt.Fprintf(e.stdout, "%s: %s plan\n", label, name)
+		for _, line := range strings.SplitAfter(plan.String(), "\n") {
+			if line != "" {
+				fmt.Fprint(e.stdout, "  "+line)
+			}
+		}
+		if plan.Conflicts() > 0 {
+			return ExitFailure
+		}
+		return code
+	}
+
+	res := e.engine.Apply(plan)
+	for _, err := range res.Errors {
+		fmt.Fprintf(e.stderr, "lazydots: %s: %v\n", label, err)
+	}
+	if res.RolledBack {
+		fmt.Fprintf(e.stderr, "lazydots: %s: %s failed, all changes were rolled back\n", label, name)
+	} else if len(res.Errors) > 0 {
+		fmt.Fprintf(e.stderr, "lazydots: %s: %s refused because of conflicts, nothing was changed\n", label, name)
+	}
+	fmt.Fprintf(e.stdout, "%s: %s %d, skipped %d, %d errors\n", label, name, res.Done, res.Skipped, len(res.Errors))
+	if len(res.Errors) > 0 {
+		return ExitFailure
+	}
+	return code
+}
@@ -3,11 +3,102 @@ package config
 import (
     "encoding/json"
     "os"
+    "path"
     "path/filepath"
+    "sort"
 )
 
 type Config struct {
     DotfilesPath string `json:"dotfiles_path"`
+
+    // Fold links a whole directory when its target doesn't exist yet,
+    // like GNU Stow does, instead of one symlink per file.
+    Fold bool `json:"fold,omitempty"`
+
+    // Relative creates symlinks with a path relative to the link's
+    // directory, so links survive moving the repo together with $HOME.
+    Relative bool `json:"relative,omitempty"`
+
+    // Target is the directory packages are linked into. Empty means $HOME.
+    // A leading "~" and environment variables are expanded.
+    Target string `json:"target,omitempty"`
+
+    // Mapping selects how package files map to target paths: "stow"
+    // (the default, 1:1 like GNU Stow) or "legacy", which strips the
+    // first path segment unless it starts with ".".
+    Mapping string `json:"mapping,omitempty"`
+
+    // Dotfiles renames files and directories starting with "dot-" to
+    // start with "." in the target, like stow --dotfiles.
+    Dotfiles bool `json:"dotfiles,omitempty"`
+
+    // Packages holds per-package settings, keyed by package name.
+    Packages map[string]PackageConfig `json:"packages,omitempty"`
+
+    // Profiles are named sets of packages, e.g. "laptop" or "work".
+    Profiles map[string]Profile `json:"profiles,omitempty"`
+
+    // Profile is the active profile. Empty means the profile whose hosts
+    // match this machine's hostname, if any.
+    Profile string `json:"profile,omitempty"`
+
+    // Templates renders package files ending in ".tmpl" into their
+    // target instead of linking them.
+    Templates bool `json:"templates,omitempty"`
+
+    // Vars are extra variables for templates, as {{ .Vars.name }}.
+    Vars map[string]string `json:"vars,omitempty"`
+
+    // Identity is the age identity (key) file that secrets ending in
+    // ".age" are decrypted with. Empty means key.txt next to this config.
+    Identity string `json:"identity,omitempty"`
+}
+
+// Profile is a named set of packages linked together on some machines.
+type Profile struct {
+    Packages []string `json:"packages"`
+
+    // Hosts are hostnames (or glob patterns like "work-*") that select
+    // this profile automatically.
+    Hosts []string `json:"hosts,omitempty"`
+}
+
+// ActiveProfile returns the name of the active profile: Profile if set,
+// otherwise the first profile (by name) with a host matching hostname.
+// It returns "" if no profile applies.
+func (c Config) ActiveProfile(hostname string) string {
+    if c.Profile != "" {
+        return c.Profile
+    }
+    for _, name := range c.ProfileNames() {
+        for _, pattern := range c.Profiles[name].Hosts {
+            if ok, _ := path.Match(pattern, hostname); ok {
+                return name
+            }
+        }
+    }
+    return ""
+}
+
+// ProfileNames returns the names of all profiles, sorted.
+func (c Config) ProfileNames() []string {
+    names := make([]string, 0, len(c.Profiles))
+    for name := range c.Profiles {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// PackageConfig overrides settings for a single package.
+type PackageConfig struct {
+    // Target is the directory this package is linked into instead of
+    // Config.Target, e.g. "/etc" or "$XDG_CONFIG_HOME".
+    Target string `json:"target,omitempty"`
+
+    // Copy copies this package's files to their targets instead of
+    // linking them, for tools that don't work with symlinks.
+    Copy bool `json:"copy,omitempty"`
 }
 
 func Path() string {
@@ -19,6 +110,19 @@ func Path() string {
     return filepath.Join(home, ".config", "lazydots", "config.json")
 }
 
+// StateDir returns the directory lazydots keeps backups and other state
+// in: $XDG_STATE_HOME/lazydots, or ~/.local/state/lazydots.
+func StateDir() string {
+    if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+        return filepath.Join(dir, "lazydots")
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return filepath.Join(".", ".local", "state", "lazydots")
+    }
+    return filepath.Join(home, ".local", "state", "lazydots")
+}
+
 func Exists() bool {
     _, err := os.Stat(Path())
     return err == nil
@@ -62,3 +62,17 @@ func Pull(repoPath string) error {
 	}
 	return nil
 }
+
+// DiffFiles returns a unified diff from file a to file b, which don't have
+// to be inside a repository. The diff is empty if the files are identical.
+func DiffFiles(a, b string) (string, error) {
+	cmd := exec.Command("git", "diff", "--no-index", "--no-color", "--", a, b)
+	out, err := cmd.Output()
+	if err != nil {
+		// Exit status 1 just means the files differ.
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			return "", fmt.Errorf("git diff failed: %v", err)
+		}
+	}
+	return string(out), nil
+}
@@ -0,0 +1,116 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SourceFor returns the path inside the package name that links to target,
+// using the inverse of the planner's TargetMapper.
+func (p *Planner) SourceFor(name, target string) (string, error) {
+	dir := p.TargetDirFor(name)
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not inside the target directory %s", target, dir)
+	}
+	src, ok := p.mapper().Unmap(rel)
+	if !ok || p.TargetFor(name, src) != filepath.Join(dir, rel) {
+		return "", fmt.Errorf("no path in package %s maps to %s", name, target)
+	}
+	return src, nil
+}
+
+// Add moves the unmanaged file or directory at path into the package at
+// pkgPath and links it back in its place. Directories are moved whole and
+// permissions are kept. It returns the entries for the added files.
+func (e *Engine) Add(pkgPath, path string) ([]Entry, error) {
+	name := filepath.Base(pkgPath)
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s is a symlink; only regular files and directories can be added", path)
+	}
+	if within(path, e.Root) || within(e.Root, path) {
+		return nil, fmt.Errorf("%s overlaps the dotfiles repository", path)
+	}
+
+	rel, err := e.SourceFor(name, path)
+	if err != nil {
+		return nil, err
+	}
+	src := filepath.Join(pkgPath, rel)
+	if _, err := os.Lstat(src); err == nil {
+		return nil, fmt.Errorf("%s already exists in package %s", rel, name)
+	}
+	ig, err := e.Ignore(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	if ig.Match(rel, info.IsDir()) {
+		return nil, fmt.Errorf("%s is ignored in package %s", rel, name)
+	}
+	if info.IsDir() {
+		// Ignored files would vanish from the target once moved.
+		err := filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			below, _ := filepath.Rel(path, p)
+			if ig.Match(filepath.Join(rel, below), d.IsDir()) {
+				return fmt.Errorf("%s contains %s, which is ignored in package %s", path, below, name)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := move(path, src); err != nil {
+		return nil, fmt.Errorf("move failed: %w", err)
+	}
+
+	// Link everything that was moved.
+	all, err := e.Scan(pkgPath)
+	if err != nil {
+		return nil, errors.Join(err, move(src, path))
+	}
+	var entries []Entry
+	for _, entry := range all {
+		if entry.Rel == rel || within(entry.Source, src) {
+			entries = append(entries, entry)
+		}
+	}
+	plan := e.PlanLink(entries)
+	for i, a := range plan.Actions {
+		// Directories recreated in the target keep the moved ones' permissions.
+		if a.Kind != ActionMkdir || !within(a.Path, path) {
+			continue
+		}
+		if r, err := e.SourceFor(name, a.Path); err == nil {
+			if info, err := os.Stat(filepath.Join(pkgPath, r)); err == nil {
+				plan.Actions[i].Mode = info.Mode().Perm()
+			}
+		}
+	}
+	res, steps := e.apply(plan)
+	if len(res.Errors) > 0 {
+		return nil, errors.Join(append(res.Errors, move(src, path))...)
+	}
+	e.appendJournal(JournalEntry{Op: "add", Moved: &Move{From: path, To: src}, Changes: changes(steps)})
+
+	for i := range entries {
+		entries[i] = e.Refresh(entries[i])
+	}
+	return entries, nil
+}
@@ -0,0 +1,172 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapper  TargetMapper
+		fold    bool
+		files   []string // created below home, relative to it
+		add     string   // path to add, relative to home
+		wantSrc []string // package files afterwards, relative to the package
+	}{
+		{
+			name:    "file",
+			files:   []string{".config/foo/bar.conf"},
+			add:     ".config/foo/bar.conf",
+			wantSrc: []string{".config/foo/bar.conf"},
+		},
+		{
+			name:    "directory",
+			files:   []string{".config/foo/bar.conf", ".config/foo/themes/dark.conf"},
+			add:     ".config/foo",
+			wantSrc: []string{".config/foo/bar.conf", ".config/foo/themes/dark.conf"},
+		},
+		{
+			name:    "directory folded",
+			fold:    true,
+			files:   []string{".config/foo/bar.conf", ".config/foo/themes/dark.conf"},
+			add:     ".config/foo",
+			wantSrc: []string{".config/foo/bar.conf", ".config/foo/themes/dark.conf"},
+		},
+		{
+			name:    "dot prefix",
+			mapper:  DotfilesMapper{},
+			files:   []string{".bashrc"},
+			add:     ".bashrc",
+			wantSrc: []string{"dot-bashrc"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, home := testRepo(t)
+			pkg := filepath.Join(root, "foo")
+			for _, f := range tt.files {
+				writeFile(t, filepath.Join(home, f), f)
+				if err := os.Chmod(filepath.Join(home, f), 0o600); err != nil {
+					t.Fatalf("chmod failed: %v", err)
+				}
+			}
+
+			p := NewPlanner(root, home)
+			p.Mapper = tt.mapper
+			p.Fold = tt.fold
+			e := NewEngine(p)
+
+			entries, err := e.Add(pkg, filepath.Join(home, tt.add))
+			if err != nil {
+				t.Fatalf("Add() unexpected error: %v", err)
+			}
+			if len(entries) != len(tt.wantSrc) {
+				t.Fatalf("Add() returned %d entries, want %d: %+v", len(entries), len(tt.wantSrc), entries)
+			}
+			for _, entry := range entries {
+				if entry.Status != StatusLinked {
+					t.Errorf("%s status = %v, want linked", entry.Rel, entry.Status)
+				}
+			}
+
+			for i, rel := range tt.wantSrc {
+				src := filepath.Join(pkg, rel)
+				info, err := os.Lstat(src)
+				if err != nil || !info.Mode().IsRegular() {
+					t.Errorf("package file %s = %v (err %v), want a regular file", rel, info, err)
+					continue
+				}
+				if info.Mode().Perm() != 0o600 {
+					t.Errorf("package file %s mode = %v, want 0600", rel, info.Mode().Perm())
+				}
+				if got := readFile(t, filepath.Join(home, tt.files[i])); got != tt.files[i] {
+					t.Errorf("%s reads %q through the link, want %q", tt.files[i], got, tt.files[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAddKeepsDirectoryMode(t *testing.T) {
+	root, home := testRepo(t)
+	e := journalEngine(t, root, home)
+	path := filepath.Join(home, ".gnupg")
+	writeFile(t, filepath.Join(path, "private-keys-v1.d", "key"), "")
+	for _, dir := range []string{path, filepath.Join(path, "private-keys-v1.d")} {
+		if err := os.Chmod(dir, 0o700); err != nil {
+			t.Fatalf("chmod failed: %v", err)
+		}
+	}
+
+	checkMode := func(when string) {
+		t.Helper()
+		for _, dir := range []string{path, filepath.Join(path, "private-keys-v1.d")} {
+			info, err := os.Lstat(dir)
+			if err != nil {
+				t.Errorf("%s %s: %v", dir, when, err)
+			} else if !info.IsDir() || info.Mode().Perm() != 0o700 {
+				t.Errorf("%s %s mode = %v, want a 0700 directory", dir, when, info.Mode())
+			}
+		}
+	}
+
+	if _, err := e.Add(filepath.Join(root, "gnupg"), path); err != nil {
+		t.Fatalf("Add() unexpected error: %v", err)
+	}
+	checkMode("after add")
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	checkMode("after undo")
+	if _, err := e.Redo(); err != nil {
+		t.Fatalf("Redo() unexpected error: %v", err)
+	}
+	checkMode("after redo")
+}
+
+func TestAddErrors(t *testing.T) {
+	root, home := testRepo(t)
+	pkg := filepath.Join(root, "foo")
+	writeFile(t, filepath.Join(pkg, ".existing"), "")
+	writeFile(t, filepath.Join(home, ".existing"), "")
+	writeFile(t, filepath.Join(home, "proj", "README.md"), "")
+	writeFile(t, filepath.Join(home, "proj", ".git", "HEAD"), "")
+	symlink(t, filepath.Join(home, ".existing"), filepath.Join(home, ".alias"))
+	outside := filepath.Join(filepath.Dir(root), "outside")
+	writeFile(t, outside, "")
+
+	legacy := NewPlanner(root, home)
+	legacy.Mapper = LegacyMapper{}
+
+	tests := []struct {
+		name string
+		e    *Engine
+		path string
+	}{
+		{name: "missing", e: NewEngine(NewPlanner(root, home)), path: filepath.Join(home, ".nope")},
+		{name: "symlink", e: NewEngine(NewPlanner(root, home)), path: filepath.Join(home, ".alias")},
+		{name: "outside target", e: NewEngine(NewPlanner(root, home)), path: outside},
+		{name: "already in package", e: NewEngine(NewPlanner(root, home)), path: filepath.Join(home, ".existing")},
+		{name: "contains ignored files", e: NewEngine(NewPlanner(root, home)), path: filepath.Join(home, "proj")},
+		{name: "repository", e: NewEngine(NewPlanner(root, home)), path: root},
+		{name: "no inverse mapping", e: NewEngine(legacy), path: filepath.Join(home, "proj", "README.md")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.e.Add(pkg, tt.path); err == nil {
+				t.Errorf("Add(%s) expected error, got nil", tt.path)
+			}
+		})
+	}
+
+	// Nothing was moved.
+	for _, path := range []string{filepath.Join(home, ".existing"), filepath.Join(home, "proj", ".git", "HEAD")} {
+		if _, err := os.Lstat(path); err != nil {
+			t.Errorf("failed Add() moved %s: %v", path, err)
+		}
+	}
+}
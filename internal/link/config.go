@@ -0,0 +1,116 @@
+package link
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/fs"
+)
+
+// FromConfig returns an Engine for the repository and options in cfg. It
+// refuses an unknown mapping and target directories that don't expand to
+// absolute paths.
+func FromConfig(cfg config.Config) (*Engine, error) {
+	targetDir := DefaultTargetDir()
+	if cfg.Target != "" {
+		dir, err := ExpandTarget(cfg.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target: %w", err)
+		}
+		targetDir = dir
+	}
+
+	p := NewPlanner(cfg.DotfilesPath, targetDir)
+	p.GlobalIgnore = filepath.Join(DefaultTargetDir(), GlobalIgnoreFile)
+	p.BackupDir = filepath.Join(config.StateDir(), "backups")
+	p.Fold = cfg.Fold
+	p.Relative = cfg.Relative
+	p.Templates = cfg.Templates
+	p.TemplateData = templateData(cfg)
+	p.Identity = filepath.Join(filepath.Dir(config.Path()), "key.txt")
+	if cfg.Identity != "" {
+		dir, err := ExpandTarget(cfg.Identity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity: %w", err)
+		}
+		p.Identity = dir
+	}
+	m, ok := MapperFor(cfg.Mapping)
+	if !ok {
+		return nil, fmt.Errorf("unknown mapping %q (want %q or %q)", cfg.Mapping, MappingStow, MappingLegacy)
+	}
+	p.Mapper = m
+	if cfg.Dotfiles {
+		p.Mapper = DotfilesMapper{Mapper: p.Mapper}
+	}
+	p.Synced = filepath.Join(config.StateDir(), "synced.json")
+	p.Journal = filepath.Join(config.StateDir(), "journal.jsonl")
+	for name, pc := range cfg.Packages {
+		if pc.Copy {
+			if p.Copies == nil {
+				p.Copies = map[string]bool{}
+			}
+			p.Copies[name] = true
+		}
+		if pc.Target == "" {
+			continue
+		}
+		if p.Targets == nil {
+			p.Targets = map[string]string{}
+		}
+		dir, err := ExpandTarget(pc.Target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid target for package %s: %w", name, err)
+		}
+		p.Targets[name] = dir
+	}
+	return NewEngine(p), nil
+}
+
+// templateData returns what templates are rendered with on this machine.
+func templateData(cfg config.Config) TemplateData {
+	hostname, _ := os.Hostname()
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return TemplateData{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		User:     name,
+		Home:     DefaultTargetDir(),
+		Profile:  cfg.ActiveProfile(hostname),
+		Vars:     cfg.Vars,
+	}
+}
+
+// ExpandTarget expands environment variables and a leading "~" in the
+// configured path dir. A variable that is unset or empty is an error, and
+// so is a path that isn't absolute once expanded: it would depend on the
+// directory lazydots happens to run in.
+func ExpandTarget(dir string) (string, error) {
+	var unset []string
+	expanded := os.Expand(dir, func(name string) string {
+		value := os.Getenv(name)
+		if value == "" {
+			unset = append(unset, "$"+name)
+		}
+		return value
+	})
+	if strings.TrimSpace(dir) == "" {
+		return "", fs.ErrEmptyPath
+	}
+	if len(unset) > 0 {
+		return "", fmt.Errorf("%s: %s is not set", dir, strings.Join(unset, ", "))
+	}
+	if expanded != "~" && !strings.HasPrefix(expanded, "~/") && !filepath.IsAbs(expanded) {
+		return "", fmt.Errorf("%s: not an absolute path", dir)
+	}
+	return fs.ResolvePath(expanded)
+}
@@ -0,0 +1,72 @@
+package link
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/anakafeel/LazyDots/internal/config"
+)
+
+func TestExpandTarget(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("LAZYDOTS_TEST_DIR", "/srv/dots")
+	t.Setenv("LAZYDOTS_TEST_UNSET", "")
+
+	for dir, want := range map[string]string{
+		"~":                           home,
+		"~/.config":                   filepath.Join(home, ".config"),
+		"$LAZYDOTS_TEST_DIR":          "/srv/dots",
+		"${LAZYDOTS_TEST_DIR}/nested": "/srv/dots/nested",
+		"/etc":                        "/etc",
+	} {
+		got, err := ExpandTarget(dir)
+		if err != nil || got != want {
+			t.Errorf("ExpandTarget(%q) = %q, %v; want %q", dir, got, err, want)
+		}
+	}
+
+	for _, dir := range []string{
+		"",
+		"$LAZYDOTS_TEST_UNSET",
+		"$LAZYDOTS_TEST_UNSET/foo",
+		"dots",
+		"./dots",
+	} {
+		if got, err := ExpandTarget(dir); err == nil {
+			t.Errorf("ExpandTarget(%q) = %q, want an error", dir, got)
+		}
+	}
+}
+
+func TestFromConfigUnsetTarget(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "")
+	cfg := config.Config{
+		DotfilesPath: t.TempDir(),
+		Packages:     map[string]config.PackageConfig{"xdg": {Target: "$XDG_CONFIG_HOME"}},
+	}
+	if _, err := FromConfig(cfg); err == nil {
+		t.Error("FromConfig() with $XDG_CONFIG_HOME unset succeeded")
+	}
+
+	cfg.Packages = nil
+	cfg.Target = "$XDG_CONFIG_HOME/foo"
+	if _, err := FromConfig(cfg); err == nil {
+		t.Error("FromConfig() linking into /foo succeeded")
+	}
+}
+
+func TestFromConfigUnknownMapping(t *testing.T) {
+	cfg := config.Config{DotfilesPath: t.TempDir(), Mapping: "legcy"}
+	if _, err := FromConfig(cfg); err == nil {
+		t.Error("FromConfig() with an unknown mapping succeeded")
+	}
+	cfg.Mapping = MappingLegacy
+	e, err := FromConfig(cfg)
+	if err != nil {
+		t.Fatalf("FromConfig() unexpected error: %v", err)
+	}
+	if _, ok := e.Mapper.(LegacyMapper); !ok {
+		t.Errorf("FromConfig() mapper = %T, want LegacyMapper", e.Mapper)
+	}
+}
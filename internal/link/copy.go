@@ -0,0 +1,40 @@
+package link
+
+import "fmt"
+
+// isCopy reports whether the package file src is copied to its target
+// instead of linked: its package is copied as a whole (Planner.Copies), or
+// its manifest lists it under "copy".
+func (p *Planner) isCopy(src string) bool {
+	if p.Copies[packageOf(p.Root, src)] {
+		return true
+	}
+	return p.manifestLists(src, func(m Manifest) []string { return m.Copy })
+}
+
+// classify sets the flags saying how e's target is produced from its
+// source. A template or secret is never also a copy.
+func (p *Planner) classify(e Entry) Entry {
+	e.Template = p.isTemplate(e.Source)
+	e.Secret = !e.Template && p.isSecret(e.Source)
+	e.Copy = !e.Template && !e.Secret && p.isCopy(e.Source)
+	return e
+}
+
+// Pull copies the modified target of a copied file (or secret) back into
+// its package, keeping the previous package file as a backup. This is
+// adopting the target, which stays where it is.
+func (e *Engine) Pull(entry Entry) (Backup, error) {
+	entry = e.Refresh(entry)
+	if !entry.Copy && !entry.Secret {
+		return Backup{}, fmt.Errorf("%s is linked, not copied", entry.Target)
+	}
+	if entry.Conflict != ConflictDrift {
+		return Backup{}, fmt.Errorf("%s has no changes to pull", entry.Target)
+	}
+	b, err := e.resolve(entry, ResolveAdopt)
+	if err == nil {
+		e.appendJournal(JournalEntry{Op: "pull", Backup: &b, Entry: &entry})
+	}
+	return b, err
+}
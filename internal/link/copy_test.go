@@ -0,0 +1,121 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func copyEngine(t *testing.T, root, home string) *Engine {
+	t.Helper()
+	p := NewPlanner(root, home)
+	p.Copies = map[string]bool{"app": true}
+	p.Synced = filepath.Join(t.TempDir(), "synced.json")
+	return NewEngine(p)
+}
+
+func TestCopyStatus(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "app", ".apprc")
+	writeFile(t, src, "v1\n")
+	e := copyEngine(t, root, home)
+	target := filepath.Join(home, ".apprc")
+
+	entries, err := e.Scan(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if !entries[0].Copy {
+		t.Fatalf("Scan() = %+v, want a copied entry", entries[0])
+	}
+	if res := e.Apply(e.PlanLink(entries)); len(res.Errors) > 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+	if info, err := os.Lstat(target); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("target is not a regular file: %v", err)
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after copy = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+
+	// Only the source changed: stale, and linking updates the copy.
+	writeFile(t, src, "v2\n")
+	if entry := e.Refresh(entries[0]); entry.Conflict != ConflictStale {
+		t.Errorf("after editing the source conflict = %v, want stale", entry.Conflict)
+	}
+	if res := e.Apply(e.PlanLink(entries)); len(res.Errors) > 0 {
+		t.Fatalf("Apply(PlanLink()) on a stale copy errors: %v", res.Errors)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "v2\n" {
+		t.Errorf("target after update = %q, want v2", got)
+	}
+
+	// Only the target changed: drift, and linking leaves it alone.
+	writeFile(t, target, "edited\n")
+	if entry := e.Refresh(entries[0]); entry.Conflict != ConflictDrift {
+		t.Errorf("after editing the target conflict = %v, want drift", entry.Conflict)
+	}
+	if plan := e.PlanLink(entries); plan.Conflicts() != 1 {
+		t.Errorf("PlanLink() on a modified copy = %+v, want a skip", plan.Actions)
+	}
+}
+
+func TestPull(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "app", ".apprc")
+	writeFile(t, src, "v1\n")
+	e := copyEngine(t, root, home)
+	target := filepath.Join(home, ".apprc")
+
+	entries, err := e.Scan(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if _, err := e.Pull(entries[0]); err == nil {
+		t.Error("Pull() of a missing copy succeeded")
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	writeFile(t, target, "edited\n")
+
+	b, err := e.Pull(entries[0])
+	if err != nil {
+		t.Fatalf("Pull() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(src); string(got) != "edited\n" {
+		t.Errorf("source after pull = %q, want the edited target", got)
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after pull = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+
+	if err := e.Restore(b); err != nil {
+		t.Fatalf("Restore() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(src); string(got) != "v1\n" {
+		t.Errorf("source after restore = %q, want v1", got)
+	}
+	// The edits must not look like a stale copy that linking would replace.
+	if entry := e.Refresh(entries[0]); entry.Conflict != ConflictDrift {
+		t.Errorf("conflict after restore = %v, want drift", entry.Conflict)
+	}
+}
+
+func TestCopyFromManifest(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "app", ".config", "app", "settings.json"), "{}")
+	writeFile(t, filepath.Join(root, "app", ".config", "app", "theme.json"), "{}")
+	writeFile(t, filepath.Join(root, "app", ".apprc"), "")
+	writeFile(t, filepath.Join(root, "app", ManifestFile), `{"copy": [".config/app/"]}`)
+
+	entries, err := NewPlanner(root, home).Scan(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	for _, entry := range entries {
+		if want := entry.Rel != ".apprc"; entry.Copy != want {
+			t.Errorf("%s: Copy = %v, want %v", entry.Rel, entry.Copy, want)
+		}
+	}
+}
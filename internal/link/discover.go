@@ -0,0 +1,188 @@
+package link
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Candidate is an unmanaged file or directory in the home directory that
+// looks like configuration worth adding to a package.
+type Candidate struct {
+	Path    string // absolute path
+	Rel     string // path relative to the home directory
+	Package string // suggested package name
+	IsDir   bool
+}
+
+// DiscoverOptions limits what Discover looks at.
+type DiscoverOptions struct {
+	MaxDepth int      // directory levels below home to look at; 0 means 2
+	Ignore   []string // gitignore patterns relative to home, on top of DefaultDiscoverIgnore
+	Skip     string   // directory never reported, usually the dotfiles repository
+}
+
+// DefaultDiscoverIgnore leaves out caches, application data, secrets and
+// history files, in gitignore syntax relative to home.
+var DefaultDiscoverIgnore = []string{
+	".cache/", ".local/share/", ".local/state/", ".var/", ".Trash/",
+	".npm/", ".cargo/", ".rustup/", ".go/", ".m2/", ".gradle/", "node_modules/",
+	".mozilla/", ".dbus/", ".pki/", ".gnupg/", ".ssh/", ".git/", ".vscode/",
+	".config/pulse/", ".config/dconf/", ".config/lazydots/",
+	".config/google-chrome/", ".config/chromium/", ".config/BraveSoftware/",
+	".config/Code/", ".config/discord/", ".config/Slack/",
+	"*_history", "*.history", ".lesshst", ".viminfo", ".wget-hsts",
+	".Xauthority", ".ICEauthority", ".xsession-errors*", ".zcompdump*",
+	".sudo_as_admin_successful", ".DS_Store", "*.lock", "*.pid", "*.sock",
+}
+
+// maxCandidateSize leaves out big files, which are rarely hand-written config.
+const maxCandidateSize = 1 << 20
+
+// configRoots are directories whose children are each an app's config.
+var configRoots = map[string]bool{
+	".config": true,
+}
+
+// knownPackages maps well-known locations to the package they belong in.
+var knownPackages = map[string]string{
+	".bashrc":           "bash",
+	".bash_profile":     "bash",
+	".bash_aliases":     "bash",
+	".bash_logout":      "bash",
+	".zshrc":            "zsh",
+	".zprofile":         "zsh",
+	".zshenv":           "zsh",
+	".zlogin":           "zsh",
+	".profile":          "shell",
+	".inputrc":          "readline",
+	".gitconfig":        "git",
+	".gitignore_global": "git",
+	".gitattributes":    "git",
+	".vimrc":            "vim",
+	".vim":              "vim",
+	".gvimrc":           "vim",
+	".emacs":            "emacs",
+	".emacs.d":          "emacs",
+	".tmux.conf":        "tmux",
+	".screenrc":         "screen",
+	".Xresources":       "x11",
+	".Xdefaults":        "x11",
+	".xinitrc":          "x11",
+	".xprofile":         "x11",
+	".local/bin":        "bin",
+}
+
+// Discover walks home looking for configuration that isn't managed yet:
+// top-level dotfiles, every app directory in ~/.config and other well-known
+// locations. Symlinks are skipped since they are usually managed already.
+// Candidates are sorted by suggested package.
+func Discover(home string, opts DiscoverOptions) ([]Candidate, error) {
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = 2
+	}
+	ig := &Ignore{}
+	for _, line := range append(append([]string{}, DefaultDiscoverIgnore...), opts.Ignore...) {
+		if gp, ok := parseGitPattern(line); ok {
+			ig.git = append(ig.git, gp)
+		}
+	}
+
+	var found []Candidate
+	err := filepath.WalkDir(home, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == home {
+				return err
+			}
+			// Unreadable corners of $HOME are not worth failing over.
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(home, path)
+		if rel == "." {
+			return nil
+		}
+		depth := strings.Count(rel, string(filepath.Separator)) + 1
+		hidden := strings.HasPrefix(d.Name(), ".")
+
+		skip := func() error {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 || ig.Match(rel, d.IsDir()) {
+			return skip()
+		}
+		if opts.Skip != "" && within(path, opts.Skip) {
+			return skip()
+		}
+
+		_, known := knownPackages[filepath.ToSlash(rel)]
+		inRoot := configRoots[filepath.ToSlash(filepath.Dir(rel))]
+		candidate := known || inRoot || (depth == 1 && hidden && !d.IsDir())
+		if candidate && !d.IsDir() {
+			if info, err := d.Info(); err != nil || !info.Mode().IsRegular() || info.Size() > maxCandidateSize {
+				candidate = false
+			}
+		}
+		if candidate {
+			found = append(found, Candidate{
+				Path:    path,
+				Rel:     rel,
+				Package: suggestPackage(filepath.ToSlash(rel)),
+				IsDir:   d.IsDir(),
+			})
+			// A directory is adopted whole.
+			return skip()
+		}
+
+		if d.IsDir() && (depth >= maxDepth || (depth == 1 && !hidden)) {
+			// Stop at the depth limit; visible top-level directories hold
+			// documents, not config.
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Package != found[j].Package {
+			return found[i].Package < found[j].Package
+		}
+		return found[i].Rel < found[j].Rel
+	})
+	return found, nil
+}
+
+// suggestPackage guesses a package name for the slash-separated path rel
+// below home, usually the app it configures.
+func suggestPackage(rel string) string {
+	if name, ok := knownPackages[rel]; ok {
+		return name
+	}
+
+	name, inRoot := rel, false
+	if parent, base, ok := strings.Cut(rel, "/"); ok && configRoots[parent] {
+		name, inRoot = base, true
+	}
+	name = strings.TrimPrefix(name, ".")
+	if i := strings.IndexAny(name, "./"); i > 0 {
+		name = name[:i]
+	}
+	if !inRoot {
+		// .npmrc -> npm
+		name = strings.TrimSuffix(name, "rc")
+	}
+	name = strings.ToLower(strings.Trim(name, "_-"))
+	if name == "" {
+		return "misc"
+	}
+	return name
+}
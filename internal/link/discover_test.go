@@ -0,0 +1,101 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	root, home := testRepo(t)
+	for _, f := range []string{
+		".bashrc",
+		".bash_profile",
+		".gitconfig",
+		".npmrc",
+		".bash_history",
+		".config/nvim/init.lua",
+		".config/nvim/lua/plugins.lua",
+		".config/starship.toml",
+		".config/pulse/cookie",
+		".cache/thing/data",
+		".local/bin/backup",
+		".local/share/app/db",
+		".ssh/config",
+		".dotfiles/bash/.bashrc",
+		"Documents/.hidden",
+		"notes.txt",
+	} {
+		writeFile(t, filepath.Join(home, f), "")
+	}
+	symlink(t, filepath.Join(root, "zsh", ".zshrc"), filepath.Join(home, ".zshrc"))
+
+	got, err := Discover(home, DiscoverOptions{Skip: filepath.Join(home, ".dotfiles"), Ignore: []string{".npmrc"}})
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+
+	want := []Candidate{
+		{Rel: ".bash_profile", Package: "bash"},
+		{Rel: ".bashrc", Package: "bash"},
+		{Rel: ".local/bin", Package: "bin", IsDir: true},
+		{Rel: ".gitconfig", Package: "git"},
+		{Rel: ".config/nvim", Package: "nvim", IsDir: true},
+		{Rel: ".config/starship.toml", Package: "starship"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Discover() = %+v, want %d candidates", got, len(want))
+	}
+	for i, w := range want {
+		w.Rel = filepath.FromSlash(w.Rel)
+		w.Path = filepath.Join(home, w.Rel)
+		if got[i] != w {
+			t.Errorf("Discover()[%d] = %+v, want %+v", i, got[i], w)
+		}
+	}
+}
+
+func TestDiscoverDepth(t *testing.T) {
+	_, home := testRepo(t)
+	writeFile(t, filepath.Join(home, ".config", "nvim", "init.lua"), "")
+	writeFile(t, filepath.Join(home, ".bashrc"), "")
+	if err := os.WriteFile(filepath.Join(home, ".big"), []byte(strings.Repeat("x", maxCandidateSize+1)), 0o644); err != nil {
+		t.Fatalf("failed to write big file: %v", err)
+	}
+
+	got, err := Discover(home, DiscoverOptions{MaxDepth: 1})
+	if err != nil {
+		t.Fatalf("Discover() unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Rel != ".bashrc" {
+		t.Errorf("Discover(MaxDepth: 1) = %+v, want only .bashrc", got)
+	}
+}
+
+func TestSuggestPackage(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{rel: ".bashrc", want: "bash"},
+		{rel: ".tmux.conf", want: "tmux"},
+		{rel: ".npmrc", want: "npm"},
+		{rel: ".wgetrc", want: "wget"},
+		{rel: ".editorconfig", want: "editorconfig"},
+		{rel: ".config/nvim", want: "nvim"},
+		{rel: ".config/Kvantum", want: "kvantum"},
+		{rel: ".config/starship.toml", want: "starship"},
+		{rel: ".config/.hidden-app", want: "hidden-app"},
+		{rel: ".local/bin", want: "bin"},
+		{rel: ".rc", want: "misc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := suggestPackage(tt.rel); got != tt.want {
+				t.Errorf("suggestPackage(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OrphanKind says what is wrong with a symlink into the repository.
+type OrphanKind int
+
+const (
+	OrphanBroken  OrphanKind = iota // the symlink resolves to nothing
+	OrphanOutside                   // the symlink resolves to a file outside any package
+)
+
+func (k OrphanKind) String() string {
+	switch k {
+	case OrphanBroken:
+		return "broken"
+	case OrphanOutside:
+		return "orphaned"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the kind as its name, e.g. "broken".
+func (k OrphanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Orphan is a symlink in a target directory that points into the
+// repository but no longer belongs to any package file, usually because
+// the file was deleted or renamed in the repository.
+type Orphan struct {
+	Path string     `json:"path"` // the symlink
+	Dest string     `json:"dest"` // absolute path it points to
+	Kind OrphanKind `json:"kind"`
+}
+
+// doctorIgnore leaves out directories that hold no links worth checking
+// and are expensive to walk, in gitignore syntax relative to a target root.
+// Unlike DefaultDiscoverIgnore it keeps ~/.ssh, ~/.gnupg and the like,
+// which often hold links.
+var doctorIgnore = []string{
+	".cache/", ".local/share/", ".local/state/", ".var/", "/snap/", ".Trash/",
+	".cargo/", ".rustup/", ".npm/", ".m2/", ".gradle/", ".go/", "go/pkg/mod/",
+	"node_modules/", ".git/", ".mozilla/", ".vscode/", ".steam/",
+	".config/google-chrome/", ".config/chromium/", ".config/BraveSoftware/",
+	".config/Code/", ".config/discord/", ".config/Slack/",
+}
+
+// Doctor walks every target directory looking for symlinks that point
+// into the repository but resolve to nothing, or to something outside any
+// package. Symlinked directories are not followed and the repository itself
+// is skipped. Orphans are sorted by path.
+func (p *Planner) Doctor() ([]Orphan, error) {
+	pkgs, err := Packages(p.Root)
+	if err != nil {
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, pkg := range pkgs {
+		names[pkg.Name] = true
+	}
+	roots := []string{p.Root}
+	if real, err := filepath.EvalSymlinks(p.Root); err == nil && real != p.Root {
+		roots = append(roots, real)
+	}
+
+	ig := &Ignore{}
+	for _, line := range doctorIgnore {
+		if gp, ok := parseGitPattern(line); ok {
+			ig.git = append(ig.git, gp)
+		}
+	}
+
+	seen := map[string]bool{}
+	var orphans []Orphan
+	for _, dir := range p.targetDirs() {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == dir && errors.Is(err, fs.ErrNotExist) {
+					// Nothing has been linked here yet.
+					return nil
+				}
+				if path == dir {
+					return err
+				}
+				// Unreadable corners of the target are not worth failing over.
+				if d != nil && d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			rel, _ := filepath.Rel(dir, path)
+			if d.IsDir() {
+				if rel != "." && (within(path, p.Root) || ig.Match(rel, true)) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type()&fs.ModeSymlink == 0 || seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			dest, err := readLink(path)
+			if err != nil {
+				return nil
+			}
+			var below string
+			for _, root := range roots {
+				if r, err := filepath.Rel(root, dest); err == nil && within(dest, root) {
+					below = r
+					break
+				}
+			}
+			if below == "" {
+				// Not ours.
+				return nil
+			}
+
+			pkg, _, _ := strings.Cut(filepath.ToSlash(below), "/")
+			switch {
+			case !exists(path):
+				orphans = append(orphans, Orphan{Path: path, Dest: dest, Kind: OrphanBroken})
+			case below == "." || !names[pkg]:
+				orphans = append(orphans, Orphan{Path: path, Dest: dest, Kind: OrphanOutside})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(orphans, func(i, j int) bool { return orphans[i].Path < orphans[j].Path })
+	return orphans, nil
+}
+
+// targetDirs returns every directory packages are linked into, without
+// duplicates.
+func (p *Planner) targetDirs() []string {
+	dirs := []string{p.TargetDir}
+	for _, dir := range p.Targets {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs[1:])
+
+	var unique []string
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if abs, err := filepath.Abs(dir); err == nil && !seen[abs] {
+			seen[abs] = true
+			unique = append(unique, abs)
+		}
+	}
+	return unique
+}
+
+// exists reports whether path resolves to an existing file, following
+// symlinks.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Prune removes the orphaned symlink o, provided it still points where it
+// did when it was found.
+func (e *Engine) Prune(o Orphan) error {
+	info, err := os.Lstat(o.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("lstat failed: %w", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s is no longer a symlink, refusing to remove", o.Path)
+	}
+	if dest, err := readLink(o.Path); err != nil || dest != o.Dest {
+		return fmt.Errorf("%s changed since it was checked, refusing to remove", o.Path)
+	}
+	raw, err := os.Readlink(o.Path)
+	if err != nil {
+		return fmt.Errorf("readlink failed: %w", err)
+	}
+	if err := os.Remove(o.Path); err != nil {
+		return fmt.Errorf("remove failed: %w", err)
+	}
+	e.appendJournal(JournalEntry{Op: "prune", Changes: []Change{{
+		Kind: ActionRemove, Target: o.Path, Source: o.Dest, Relative: !filepath.IsAbs(raw),
+	}}})
+	return nil
+}
@@ -0,0 +1,97 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDoctor(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "nvim", ".config", "nvim", "init.lua"), "")
+	writeFile(t, filepath.Join(root, "README.md"), "")
+	writeFile(t, filepath.Join(home, "elsewhere"), "")
+
+	// Healthy links: a file, a folded directory and a link out of the repo.
+	symlink(t, filepath.Join(root, "bash", ".bashrc"), filepath.Join(home, ".bashrc"))
+	symlink(t, filepath.Join(root, "nvim", ".config", "nvim"), filepath.Join(home, ".config", "nvim"))
+	symlink(t, filepath.Join(home, "elsewhere"), filepath.Join(home, ".other"))
+	// Broken: the file was renamed in the repository.
+	symlink(t, filepath.Join(root, "bash", ".bash_profile"), filepath.Join(home, ".bash_profile"))
+	// Broken, relative and nested.
+	symlink(t, "../../dotfiles/zsh/.config/zsh/.zshrc", filepath.Join(home, ".config", ".zshrc"))
+	// Orphaned: the repository root is not a package.
+	symlink(t, filepath.Join(root, "README.md"), filepath.Join(home, "README.md"))
+	// Not ours, even though it dangles.
+	symlink(t, filepath.Join(home, "gone"), filepath.Join(home, ".gone"))
+	// Application data and module caches aren't walked.
+	symlink(t, filepath.Join(root, "bash", ".gone"), filepath.Join(home, ".local", "share", "app", ".gone"))
+	symlink(t, filepath.Join(root, "bash", ".gone"), filepath.Join(home, "go", "pkg", "mod", ".gone"))
+
+	p := NewPlanner(root, home)
+	got, err := p.Doctor()
+	if err != nil {
+		t.Fatalf("Doctor() unexpected error: %v", err)
+	}
+
+	want := []Orphan{
+		{Path: filepath.Join(home, ".bash_profile"), Dest: filepath.Join(root, "bash", ".bash_profile"), Kind: OrphanBroken},
+		{Path: filepath.Join(home, ".config", ".zshrc"), Dest: filepath.Join(root, "zsh", ".config", "zsh", ".zshrc"), Kind: OrphanBroken},
+		{Path: filepath.Join(home, "README.md"), Dest: filepath.Join(root, "README.md"), Kind: OrphanOutside},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Doctor() = %+v, want %d orphans", got, len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Doctor()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDoctorPackageTargets(t *testing.T) {
+	root, home := testRepo(t)
+	etc := filepath.Join(filepath.Dir(home), "etc")
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	symlink(t, filepath.Join(root, "hosts", "hosts"), filepath.Join(etc, "hosts"))
+
+	p := NewPlanner(root, home)
+	p.Targets = map[string]string{"hosts": etc, "missing": filepath.Join(etc, "nope")}
+	got, err := p.Doctor()
+	if err != nil {
+		t.Fatalf("Doctor() unexpected error: %v", err)
+	}
+	if len(got) != 1 || got[0].Path != filepath.Join(etc, "hosts") {
+		t.Errorf("Doctor() = %+v, want the broken link in %s", got, etc)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	root, home := testRepo(t)
+	link := filepath.Join(home, ".bash_profile")
+	symlink(t, filepath.Join(root, "bash", ".bash_profile"), link)
+
+	e := NewEngine(NewPlanner(root, home))
+	orphans, err := e.Doctor()
+	if err != nil || len(orphans) != 1 {
+		t.Fatalf("Doctor() = %+v, %v; want one orphan", orphans, err)
+	}
+
+	// A link that changed since the scan is left alone.
+	changed := orphans[0]
+	changed.Dest = filepath.Join(root, "other")
+	if err := e.Prune(changed); err == nil {
+		t.Error("Prune() of a changed link should fail")
+	}
+
+	if err := e.Prune(orphans[0]); err != nil {
+		t.Fatalf("Prune() unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(link); !os.IsNotExist(err) {
+		t.Errorf("Prune() left %s behind", link)
+	}
+	if err := e.Prune(orphans[0]); err != nil {
+		t.Errorf("Prune() of a removed link should succeed, got %v", err)
+	}
+}
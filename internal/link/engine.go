@@ -0,0 +1,129 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Result summarises a batch link or unlink operation.
+type Result struct {
+	Done       int     // entries that were linked or unlinked
+	Skipped    int     // entries that were already in the requested state
+	Errors     []error // what went wrong, including conflicts and rollback failures
+	RolledBack bool    // a step failed and every earlier step was reverted
+}
+
+// Engine applies link and unlink operations to package entries.
+type Engine struct {
+	*Planner
+}
+
+// NewEngine returns an Engine that resolves targets with p.
+func NewEngine(p *Planner) *Engine {
+	return &Engine{Planner: p}
+}
+
+// Link links a single entry, creating missing parent directories.
+func (e *Engine) Link(entry Entry) error {
+	return errors.Join(e.Apply(e.PlanLink([]Entry{entry})).Errors...)
+}
+
+// LinkWith links a single entry like Link, but with relative (or absolute)
+// symlinks regardless of the planner's setting. An entry already linked
+// with the other kind of symlink is relinked in the same transaction.
+func (e *Engine) LinkWith(entry Entry, relative bool) Result {
+	plan := e.PlanLink([]Entry{entry})
+	if raw, err := os.Readlink(entry.Target); err == nil && filepath.IsAbs(raw) == relative {
+		if e.Refresh(entry).Status == StatusLinked {
+			plan = e.PlanRestow([]Entry{entry})
+		}
+	}
+	return e.Apply(plan.WithRelative(relative))
+}
+
+// Unlink unlinks a single entry.
+func (e *Engine) Unlink(entry Entry) error {
+	entry = e.Refresh(entry)
+	if entry.Status == StatusMissing {
+		return nil
+	}
+	if entry.Status == StatusConflict {
+		return fmt.Errorf("not linked to this package: %s", entry.Reason)
+	}
+	return errors.Join(e.Apply(e.PlanUnlink([]Entry{entry})).Errors...)
+}
+
+// Toggle unlinks a linked entry and links anything else.
+func (e *Engine) Toggle(entry Entry) error {
+	if entry.Status == StatusLinked {
+		return e.Unlink(entry)
+	}
+	return e.Link(entry)
+}
+
+// Apply performs the actions of plan as a single transaction: either every
+// action succeeds, or every change made so far is reverted and the
+// filesystem is left as it was. A plan containing conflicts is refused
+// without touching anything.
+func (e *Engine) Apply(plan Plan) Result {
+	res, steps := e.apply(plan)
+	if len(steps) > 0 {
+		op := plan.Op
+		if op == "" {
+			op = "apply"
+		}
+		e.appendJournal(JournalEntry{Op: op, Changes: changes(steps)})
+	}
+	return res
+}
+
+// apply implements Apply without journaling the plan, and returns the
+// steps it took. There are none if it failed.
+func (e *Engine) apply(plan Plan) (Result, []step) {
+	res := Result{Skipped: plan.Unchanged}
+
+	if plan.Conflicts() > 0 {
+		for _, a := range plan.Actions {
+			if a.Kind == ActionSkip {
+				res.Errors = append(res.Errors, actionError(a, fmt.Errorf("%s", a.Reason)))
+			}
+		}
+		return res, nil
+	}
+
+	var steps []step
+	for _, a := range plan.Actions {
+		s, err := do(a)
+		if err != nil {
+			res.Errors = append(res.Errors, actionError(a, err))
+			res.Errors = append(res.Errors, rollback(steps)...)
+			res.RolledBack = true
+			return res, nil
+		}
+		if s != nil {
+			steps = append(steps, *s)
+		}
+	}
+
+	e.recordSynced(plan.Actions)
+
+	done := map[string]bool{} // targets changed, so restow counts each entry once
+	for _, s := range steps {
+		if s.action.Count > 0 && !done[s.action.Path] {
+			done[s.action.Path] = true
+			res.Done += s.action.Count
+		}
+	}
+	return res, steps
+}
+
+// actionError prefixes err with the entry (or path) the action is about.
+func actionError(a Action, err error) error {
+	name := a.Rel
+	if name == "" {
+		name = a.Path
+	}
+	return fmt.Errorf("%s: %w", name, err)
+}
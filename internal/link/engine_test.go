@@ -0,0 +1,154 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEngineApplyLinkAndUnlink(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "shell")
+	writeFile(t, filepath.Join(pkg, ".bashrc"), "")
+	writeFile(t, filepath.Join(pkg, ".zshrc"), "")
+	writeFile(t, filepath.Join(pkg, ".profile"), "")
+	writeFile(t, filepath.Join(home, ".zshrc"), "local")
+
+	e := NewEngine(NewPlanner(root, home))
+	entries, err := e.Scan(pkg)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	// A conflict refuses the whole batch.
+	res := e.Apply(e.PlanLink(entries))
+	if res.Done != 0 || len(res.Errors) != 1 || res.RolledBack {
+		t.Errorf("Apply(PlanLink()) with conflict = %+v, want 0 done, 1 error, no rollback", res)
+	}
+	for _, entry := range entries {
+		if e.Refresh(entry).Status == StatusLinked {
+			t.Errorf("Apply(PlanLink()) with conflict linked %s", entry.Rel)
+		}
+	}
+
+	if err := os.Remove(filepath.Join(home, ".zshrc")); err != nil {
+		t.Fatalf("failed to remove conflict: %v", err)
+	}
+
+	res = e.Apply(e.PlanLink(entries))
+	if res.Done != 3 || res.Skipped != 0 || len(res.Errors) != 0 {
+		t.Errorf("Apply(PlanLink()) = %+v, want 3 done, 0 skipped, 0 errors", res)
+	}
+	for _, entry := range entries {
+		if entry = e.Refresh(entry); entry.Status != StatusLinked {
+			t.Errorf("Apply(PlanLink()) %s status = %v, want linked", entry.Rel, entry.Status)
+		}
+	}
+
+	res = e.Apply(e.PlanLink(entries))
+	if res.Done != 0 || res.Skipped != 3 || len(res.Errors) != 0 {
+		t.Errorf("second Apply(PlanLink()) = %+v, want 0 done, 3 skipped, 0 errors", res)
+	}
+
+	res = e.Apply(e.PlanUnlink(entries))
+	if res.Done != 3 || res.Skipped != 0 || len(res.Errors) != 0 {
+		t.Errorf("Apply(PlanUnlink()) = %+v, want 3 done, 0 skipped, 0 errors", res)
+	}
+	for _, entry := range entries {
+		if entry = e.Refresh(entry); entry.Status != StatusMissing {
+			t.Errorf("Apply(PlanUnlink()) %s status = %v, want missing", entry.Rel, entry.Status)
+		}
+	}
+}
+
+func TestEngineApplyRollsBackLink(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, ".config", "nvim", "init.lua"), "")
+	writeFile(t, filepath.Join(pkg, ".vimrc"), "")
+
+	e := NewEngine(NewPlanner(root, home))
+	entries, _ := e.Scan(pkg)
+	plan := e.PlanLink(entries)
+
+	// Something appears at the last target between planning and applying.
+	writeFile(t, filepath.Join(home, ".vimrc"), "local")
+
+	res := e.Apply(plan)
+	if !res.RolledBack || res.Done != 0 || len(res.Errors) != 1 {
+		t.Fatalf("Apply() = %+v, want rollback with 1 error", res)
+	}
+
+	// Symlink and the directories created for it are gone again.
+	if _, err := os.Lstat(filepath.Join(home, ".config")); !os.IsNotExist(err) {
+		t.Errorf("Apply() rollback left %s behind", filepath.Join(home, ".config"))
+	}
+	if data, _ := os.ReadFile(filepath.Join(home, ".vimrc")); string(data) != "local" {
+		t.Errorf("Apply() rollback touched the conflicting file, got %q", data)
+	}
+}
+
+func TestEngineApplyRollsBackUnlink(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "git")
+	writeFile(t, filepath.Join(pkg, ".gitconfig"), "")
+	writeFile(t, filepath.Join(pkg, ".gitmessage"), "")
+	relDest := filepath.Join("..", "dotfiles", "git", ".gitconfig")
+	symlink(t, relDest, filepath.Join(home, ".gitconfig"))
+	symlink(t, filepath.Join(pkg, ".gitmessage"), filepath.Join(home, ".gitmessage"))
+
+	e := NewEngine(NewPlanner(root, home))
+	entries, _ := e.Scan(pkg)
+	plan := e.PlanUnlink(entries)
+
+	// The second link is replaced by a real file before we get to it.
+	if err := os.Remove(filepath.Join(home, ".gitmessage")); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+	writeFile(t, filepath.Join(home, ".gitmessage"), "local")
+
+	res := e.Apply(plan)
+	if !res.RolledBack {
+		t.Fatalf("Apply() = %+v, want rollback", res)
+	}
+
+	// The first removal is reverted with the original (relative) destination.
+	raw, err := os.Readlink(filepath.Join(home, ".gitconfig"))
+	if err != nil || raw != relDest {
+		t.Errorf("Apply() rollback restored %q (err %v), want %q", raw, err, relDest)
+	}
+}
+
+func TestEngineToggle(t *testing.T) {
+	root, home := testRepo(t)
+
+	src := filepath.Join(root, "git", ".config", "git", "config")
+	writeFile(t, src, "[user]")
+
+	e := NewEngine(NewPlanner(root, home))
+	entry := Entry{Rel: filepath.Join(".config", "git", "config"), Source: src, Target: filepath.Join(home, ".config", "git", "config")}
+	entry = e.Refresh(entry)
+
+	if err := e.Toggle(entry); err != nil {
+		t.Fatalf("Toggle() link unexpected error: %v", err)
+	}
+	entry = e.Refresh(entry)
+	if entry.Status != StatusLinked {
+		t.Fatalf("Toggle() status = %v, want linked", entry.Status)
+	}
+
+	if err := e.Toggle(entry); err != nil {
+		t.Fatalf("Toggle() unlink unexpected error: %v", err)
+	}
+	if entry = e.Refresh(entry); entry.Status != StatusMissing {
+		t.Errorf("Toggle() status = %v, want missing", entry.Status)
+	}
+
+	writeFile(t, entry.Target, "local")
+	if err := e.Toggle(e.Refresh(entry)); err == nil {
+		t.Errorf("Toggle() onto conflicting file expected error, got nil")
+	}
+}
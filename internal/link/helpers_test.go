@@ -0,0 +1,56 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testRepo creates a temporary dotfiles root and target directory.
+// Both are removed when the test finishes.
+func testRepo(t *testing.T) (root, target string) {
+	t.Helper()
+
+	tmpDir, err := os.MkdirTemp("", "lazydots-link-test-*")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	root = filepath.Join(tmpDir, "dotfiles")
+	target = filepath.Join(tmpDir, "home")
+	for _, dir := range []string{root, target} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	return root, target
+}
+
+// writeFile creates a file (and its parents) with the given content.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create parent of %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// symlink creates a symlink at path pointing to dest (and its parents).
+func symlink(t *testing.T, dest, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("failed to create parent of %s: %v", path, err)
+	}
+	if err := os.Symlink(dest, path); err != nil {
+		t.Fatalf("failed to symlink %s: %v", path, err)
+	}
+}
+
+// isSymlinkTo reports whether path is a symlink resolving to dest.
+func isSymlinkTo(path, dest string) bool {
+	got, err := readLink(path)
+	return err == nil && samePath(got, dest)
+}
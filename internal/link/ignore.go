@@ -0,0 +1,295 @@
+package link
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Ignore file names.
+const (
+	LocalIgnoreFile  = ".stow-local-ignore"  // stow regexes, per package
+	GlobalIgnoreFile = ".stow-global-ignore" // stow regexes, in $HOME
+	IgnoreFile       = ".lazydotsignore"     // gitignore syntax, repo root or package
+)
+
+// defaultIgnore is used when a package has no .stow-local-ignore and there
+// is no global ignore file. It is stow's built-in list plus common editor
+// and OS clutter.
+var defaultIgnore = []string{
+	`RCS`,
+	`.+,v`,
+	`CVS`,
+	`\.\#.+`, // CVS conflict files / emacs lock files
+	`\.cvsignore`,
+	`\.svn`,
+	`_darcs`,
+	`\.hg`,
+	`\.git`,
+	`\.gitignore`,
+	`\.gitmodules`,
+	`.+~`,    // emacs backup files
+	`\#.*\#`, // emacs autosave files
+	`\..+\.sw[po]`,
+	`\.DS_Store`,
+	`^/README.*`,
+	`^/LICENSE.*`,
+	`^/COPYING`,
+	`^/\.github`,
+	`^/\.gitlab-ci\.yml`,
+}
+
+// Ignore decides which paths inside a package are left out of scans, and
+// therefore never linked.
+type Ignore struct {
+	segment *regexp.Regexp // stow patterns without "/", matched against each name
+	path    *regexp.Regexp // stow patterns with "/", matched against "/" + rel
+	git     []gitPattern   // .lazydotsignore patterns, last match wins
+}
+
+// Ignore loads the ignore rules for the package at pkgPath:
+//
+//   - the package's .stow-local-ignore, or else the global ignore file,
+//     or else the default list, like stow;
+//   - .lazydotsignore at the repository root and in the package.
+func (p *Planner) Ignore(pkgPath string) (*Ignore, error) {
+	ig := &Ignore{}
+
+	patterns, err := readStowIgnore(filepath.Join(pkgPath, LocalIgnoreFile))
+	if errors.Is(err, fs.ErrNotExist) && p.GlobalIgnore != "" {
+		patterns, err = readStowIgnore(p.GlobalIgnore)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		patterns, err = defaultIgnore, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ig.segment, ig.path, err = compileStowIgnore(patterns); err != nil {
+		return nil, err
+	}
+
+	// Repository-level patterns see paths starting with the package name.
+	name := filepath.Base(pkgPath)
+	for _, src := range []struct{ file, prefix string }{
+		{filepath.Join(p.Root, IgnoreFile), name + "/"},
+		{filepath.Join(pkgPath, IgnoreFile), ""},
+	} {
+		gps, err := readGitIgnore(src.file, src.prefix)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		ig.git = append(ig.git, gps...)
+	}
+	return ig, nil
+}
+
+// Match reports whether rel, a path relative to the package directory, is
+// ignored. A path inside an ignored directory is ignored too.
+func (ig *Ignore) Match(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(filepath.Clean(rel))
+	if rel == "." {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		last := i == len(parts)-1
+		if ig.match(strings.Join(parts[:i+1], "/"), !last || isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// match checks a single slash-separated path against the rules.
+func (ig *Ignore) match(rel string, isDir bool) bool {
+	if rel == LocalIgnoreFile || rel == IgnoreFile || rel == ManifestFile {
+		// Ignore files and the manifest are never linked themselves.
+		return true
+	}
+	if isDir && path.Base(rel) == ".git" {
+		return true
+	}
+
+	if ig.path != nil && ig.path.MatchString("/"+rel) {
+		return true
+	}
+	if ig.segment != nil && ig.segment.MatchString(path.Base(rel)) {
+		return true
+	}
+
+	ignored := false
+	for _, gp := range ig.git {
+		if gp.dirOnly && !isDir {
+			continue
+		}
+		if gp.re.MatchString(gp.prefix + rel) {
+			ignored = !gp.negate
+		}
+	}
+	return ignored
+}
+
+// readStowIgnore reads the regexes in a stow ignore file, one per line.
+// Comments start with "#"; a literal "#" is written as "\#".
+func readStowIgnore(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.Index(line, " #"); i != -1 {
+			line = line[:i]
+		}
+		if i := strings.Index(line, "\t#"); i != -1 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// compileStowIgnore compiles stow patterns the way stow does: patterns
+// without a "/" must match a whole file name, the others match any run of
+// whole path components.
+func compileStowIgnore(patterns []string) (segment, full *regexp.Regexp, err error) {
+	var segs, paths []string
+	for _, p := range patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, nil, fmt.Errorf("invalid ignore pattern %q: %w", p, err)
+		}
+		if strings.Contains(p, "/") {
+			paths = append(paths, p)
+		} else {
+			segs = append(segs, p)
+		}
+	}
+	if len(segs) > 0 {
+		segment = regexp.MustCompile("^(" + strings.Join(segs, "|") + ")$")
+	}
+	if len(paths) > 0 {
+		full = regexp.MustCompile("(^|/)(" + strings.Join(paths, "|") + ")(/|$)")
+	}
+	return segment, full, nil
+}
+
+// gitPattern is a single .lazydotsignore line.
+type gitPattern struct {
+	re      *regexp.Regexp
+	prefix  string // prepended to package paths before matching
+	negate  bool   // "!pattern" re-includes a path
+	dirOnly bool   // "pattern/" only matches directories
+}
+
+// readGitIgnore reads a file in gitignore syntax. Patterns match paths
+// relative to the directory holding the file; prefix is the path from that
+// directory to the package.
+func readGitIgnore(file, prefix string) ([]gitPattern, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []gitPattern
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		gp, ok := parseGitPattern(sc.Text())
+		if !ok {
+			continue
+		}
+		gp.prefix = prefix
+		patterns = append(patterns, gp)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return patterns, nil
+}
+
+// parseGitPattern translates a gitignore line into a regular expression.
+// It returns false for blank lines and comments.
+func parseGitPattern(line string) (gitPattern, bool) {
+	var gp gitPattern
+	line = strings.TrimRight(line, " \t")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gp, false
+	}
+	if strings.HasPrefix(line, "!") {
+		gp.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		gp.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return gp, false
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory
+	// holding the ignore file.
+	var b strings.Builder
+	if strings.Contains(line, "/") {
+		b.WriteString("^")
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		b.WriteString("^(.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[' && strings.IndexByte(line[i+1:], ']') > 0:
+			j := i + 1 + strings.IndexByte(line[i+1:], ']')
+			class := line[i+1 : j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i = j
+		case c == '\\' && i+1 < len(line):
+			i++
+			b.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(line[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		// Malformed classes match nothing, like git.
+		return gp, false
+	}
+	gp.re = re
+	return gp, true
+}
@@ -0,0 +1,204 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStowIgnore(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		rel      string
+		isDir    bool
+		want     bool
+	}{
+		{name: "default readme", patterns: defaultIgnore, rel: "README.md", want: true},
+		{name: "default nested readme kept", patterns: defaultIgnore, rel: ".config/nvim/README.md", want: false},
+		{name: "default swap file", patterns: defaultIgnore, rel: ".config/fish/.config.fish.swp", want: true},
+		{name: "default emacs backup", patterns: defaultIgnore, rel: ".bashrc~", want: true},
+		{name: "default ds store", patterns: defaultIgnore, rel: ".config/.DS_Store", want: true},
+		{name: "default ci dir", patterns: defaultIgnore, rel: ".github/workflows/ci.yml", want: true},
+		{name: "default dotfile", patterns: defaultIgnore, rel: ".bashrc", want: false},
+		{name: "segment matches whole name", patterns: []string{`\.env`}, rel: ".envrc", want: false},
+		{name: "segment matches any depth", patterns: []string{`cache`}, rel: ".config/app/cache/data", want: true},
+		{name: "path anchored to package", patterns: []string{`^/bin`}, rel: "bin/tool", want: true},
+		{name: "path not at root", patterns: []string{`^/bin`}, rel: ".local/bin/tool", want: false},
+		{name: "path with components", patterns: []string{`\.config/secret`}, rel: ".config/secret/key", want: true},
+		{name: "git dir always", patterns: nil, rel: "sub/.git", isDir: true, want: true},
+		{name: "ignore file itself", patterns: nil, rel: LocalIgnoreFile, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := &Ignore{}
+			var err error
+			if ig.segment, ig.path, err = compileStowIgnore(tt.patterns); err != nil {
+				t.Fatalf("compileStowIgnore() unexpected error: %v", err)
+			}
+			if got := ig.Match(filepath.FromSlash(tt.rel), tt.isDir); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitIgnore(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{name: "glob anywhere", lines: []string{"*.md"}, rel: ".config/nvim/notes.md", want: true},
+		{name: "glob no match", lines: []string{"*.md"}, rel: ".config/nvim/init.lua", want: false},
+		{name: "anchored", lines: []string{"/Makefile"}, rel: "Makefile", want: true},
+		{name: "anchored not nested", lines: []string{"/Makefile"}, rel: "sub/Makefile", want: false},
+		{name: "dir only on dir", lines: []string{"cache/"}, rel: ".cache/app/cache", isDir: true, want: true},
+		{name: "dir only skips file", lines: []string{"cache/"}, rel: "cache", want: false},
+		{name: "inside ignored dir", lines: []string{"cache/"}, rel: "cache/blob", want: true},
+		{name: "double star", lines: []string{".config/**/*.log"}, rel: ".config/app/x/debug.log", want: true},
+		{name: "double star zero dirs", lines: []string{".config/**/*.log"}, rel: ".config/debug.log", want: true},
+		{name: "question mark", lines: []string{"file?.txt"}, rel: "file1.txt", want: true},
+		{name: "class", lines: []string{"*.[oa]"}, rel: "lib.a", want: true},
+		{name: "negated class", lines: []string{"v[!0-9]"}, rel: "v1", want: false},
+		{name: "negation", lines: []string{"*.md", "!KEEP.md"}, rel: "KEEP.md", want: false},
+		{name: "last match wins", lines: []string{"!KEEP.md", "*.md"}, rel: "KEEP.md", want: true},
+		{name: "comment and blank", lines: []string{"# *.lua", ""}, rel: "init.lua", want: false},
+		{name: "escaped hash", lines: []string{`\#draft`}, rel: "#draft", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := &Ignore{}
+			for _, line := range tt.lines {
+				if gp, ok := parseGitPattern(line); ok {
+					ig.git = append(ig.git, gp)
+				}
+			}
+			if got := ig.Match(filepath.FromSlash(tt.rel), tt.isDir); got != tt.want {
+				t.Errorf("Match(%q) with %q = %v, want %v", tt.rel, tt.lines, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanIgnoreFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string // relative to the repo root
+		want  []string
+	}{
+		{
+			name: "defaults",
+			files: map[string]string{
+				"pkg/.bashrc":           "",
+				"pkg/README.md":         "",
+				"pkg/LICENSE":           "",
+				"pkg/.bashrc.swp":       "",
+				"pkg/.vimrc~":           "",
+				"pkg/.github/ci.yml":    "",
+				"pkg/.config/README.md": "",
+			},
+			want: []string{".bashrc", ".config/README.md"},
+		},
+		{
+			name: "local replaces defaults",
+			files: map[string]string{
+				"pkg/.stow-local-ignore": "# only skip local files\n\\.local # machine specific\n",
+				"pkg/.bashrc":            "",
+				"pkg/.bashrc.local":      "",
+				"pkg/.local":             "",
+				"pkg/README.md":          "",
+			},
+			want: []string{".bashrc", ".bashrc.local", "README.md"},
+		},
+		{
+			name: "global when no local",
+			files: map[string]string{
+				"home/.stow-global-ignore": "^/notes\n",
+				"pkg/.bashrc":              "",
+				"pkg/notes/todo":           "",
+				"pkg/README.md":            "",
+			},
+			want: []string{".bashrc", "README.md"},
+		},
+		{
+			name: "lazydotsignore in repo and package",
+			files: map[string]string{
+				".lazydotsignore":     "pkg/.cache/\n*.bak\n",
+				"pkg/.lazydotsignore": "!keep.bak\n",
+				"pkg/.bashrc":         "",
+				"pkg/.bashrc.bak":     "",
+				"pkg/keep.bak":        "",
+				"pkg/.cache/x":        "",
+				"other/.cache/x":      "",
+			},
+			want: []string{".bashrc", "keep.bak"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, home := testRepo(t)
+			for rel, content := range tt.files {
+				path := filepath.Join(root, filepath.FromSlash(rel))
+				if dir, ok := strings.CutPrefix(rel, "home/"); ok {
+					path = filepath.Join(home, filepath.FromSlash(dir))
+				}
+				writeFile(t, path, content)
+			}
+
+			entries, err := NewPlanner(root, home).Scan(filepath.Join(root, "pkg"))
+			if err != nil {
+				t.Fatalf("Scan() unexpected error: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, filepath.ToSlash(e.Rel))
+			}
+			sort.Strings(got)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Scan() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Scan() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestScanInvalidIgnore(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "pkg", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "pkg", LocalIgnoreFile), "(unclosed\n")
+
+	if _, err := NewPlanner(root, home).Scan(filepath.Join(root, "pkg")); err == nil {
+		t.Errorf("Scan() expected error for invalid ignore pattern, got nil")
+	}
+}
+
+func TestPackagesIgnore(t *testing.T) {
+	root, _ := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "docs", "index.md"), "")
+	writeFile(t, filepath.Join(root, IgnoreFile), "/docs/\n")
+	if err := os.MkdirAll(filepath.Join(root, ".git"), 0o755); err != nil {
+		t.Fatalf("failed to create .git: %v", err)
+	}
+
+	pkgs, err := Packages(root)
+	if err != nil {
+		t.Fatalf("Packages() unexpected error: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "bash" {
+		t.Errorf("Packages() = %+v, want [bash]", pkgs)
+	}
+}
@@ -0,0 +1,351 @@
+package link
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNothingToUndo is returned by Undo (and ErrNothingToRedo by Redo) when
+// the journal holds no operation to revert (or to apply again).
+var (
+	ErrNothingToUndo = errors.New("nothing to undo")
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// JournalEntry is one line of the journal: an operation that changed the
+// filesystem. Undoing or redoing an operation is journaled too, as an
+// entry naming the operation it reverted or applied again.
+type JournalEntry struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	Op      string    `json:"op"`             // what was done, e.g. "link" or "resolve"
+	Undo    int       `json:"undo,omitempty"` // Seq of the operation this entry reverted
+	Redo    int       `json:"redo,omitempty"` // Seq of the operation this entry applied again
+	Changes []Change  `json:"changes,omitempty"`
+	Backup  *Backup   `json:"backup,omitempty"` // for a conflict resolution
+	Entry   *Entry    `json:"entry,omitempty"`  // the resolved entry, to redo a resolution
+	Moved   *Move     `json:"moved,omitempty"`  // for add: what was moved into the package
+}
+
+// Move is a file or directory moved from one path to another.
+type Move struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Change is a single filesystem change of a journaled operation. Generated
+// files are recorded by hash, so secrets never end up in the journal.
+type Change struct {
+	Kind      ActionKind  `json:"op"`
+	Target    string      `json:"target"`
+	Source    string      `json:"src,omitempty"`
+	Relative  bool        `json:"relative,omitempty"`  // the symlink was (or is to be) relative
+	Generated bool        `json:"generated,omitempty"` // a generated file rather than a symlink
+	Hash      string      `json:"hash,omitempty"`      // SHA-256 of a generated file
+	Mode      os.FileMode `json:"mode,omitempty"`      // permissions of a generated file or directory
+}
+
+// String summarizes the operation, e.g. "link (3 changes)" or
+// "resolve of ~/.bashrc".
+func (j JournalEntry) String() string {
+	switch {
+	case j.Backup != nil:
+		return fmt.Sprintf("%s of %s", j.Op, j.Backup.Target)
+	case len(j.Changes) == 1:
+		return fmt.Sprintf("%s of %s", j.Op, j.Changes[0].Target)
+	}
+	return fmt.Sprintf("%s (%d changes)", j.Op, len(j.Changes))
+}
+
+// changeOf describes the applied step s.
+func changeOf(s step) Change {
+	a := s.action
+	c := Change{Kind: a.Kind, Target: a.Path, Source: a.Source, Generated: a.Generated}
+	switch {
+	case a.Generated:
+		c.Hash, c.Mode = hash(a.Content), a.Mode
+		if a.Kind == ActionRemove {
+			c.Mode = s.mode
+		}
+	case a.Kind == ActionMkdir:
+		c.Mode = a.Mode
+	case a.Kind == ActionRmdir:
+		c.Mode = s.mode
+	case a.Kind == ActionSymlink:
+		c.Relative = a.Relative
+	case a.Kind == ActionRemove:
+		c.Relative = !filepath.IsAbs(s.prev)
+	}
+	return c
+}
+
+// appendJournal appends entry to the journal, numbering it. Failing
+// to write the journal doesn't undo the operation, so it is not an error.
+func (e *Engine) appendJournal(entry JournalEntry) {
+	if e.Journal == "" {
+		return
+	}
+	entries, _ := e.History()
+	entry.Seq = 1
+	if len(entries) > 0 {
+		entry.Seq = entries[len(entries)-1].Seq + 1
+	}
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Journal), 0o755); err != nil {
+		return
+	}
+	f, err := os.OpenFile(e.Journal, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// History reads every entry of the journal, oldest first. Lines that can't
+// be parsed, such as one cut short by a crash, are skipped.
+func (e *Engine) History() ([]JournalEntry, error) {
+	if e.Journal == "" {
+		return nil, nil
+	}
+	f, err := os.Open(e.Journal)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []JournalEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var entry JournalEntry
+		if json.Unmarshal(sc.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// stacks replays the journal into the operations that can be undone and
+// those that can be redone, most recent last. A new operation clears the
+// redo stack, like in an editor.
+func (e *Engine) stacks() (done, undone []JournalEntry, err error) {
+	entries, err := e.History()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Undo != 0:
+			if n := len(done); n > 0 {
+				undone = append(undone, done[n-1])
+				done = done[:n-1]
+			}
+		case entry.Redo != 0:
+			// The redo entry describes what was applied again, so it is
+			// what a later undo reverts.
+			if n := len(undone); n > 0 {
+				undone = undone[:n-1]
+			}
+			done = append(done, entry)
+		default:
+			done = append(done, entry)
+			undone = nil
+		}
+	}
+	return done, undone, nil
+}
+
+// Undo reverts the most recent operation that hasn't been undone yet and
+// returns it. Nothing is reverted unless every change can be reverted
+// safely: a target that changed since is left alone and reported.
+func (e *Engine) Undo() (JournalEntry, error) {
+	done, _, err := e.stacks()
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	if len(done) == 0 {
+		return JournalEntry{}, ErrNothingToUndo
+	}
+	last := done[len(done)-1]
+
+	record := JournalEntry{Op: last.Op, Undo: last.Seq}
+	if last.Backup != nil {
+		if err := e.Restore(*last.Backup); err != nil {
+			return last, err
+		}
+	} else {
+		plan, err := e.undoPlan(last.Changes)
+		if err != nil {
+			return last, err
+		}
+		res, steps := e.apply(plan)
+		if len(res.Errors) > 0 {
+			return last, errors.Join(res.Errors...)
+		}
+		record.Changes = changes(steps)
+		if m := last.Moved; m != nil {
+			// The links are gone, so the added files can go back.
+			if err := moveBack(m.To, m.From); err != nil {
+				return last, errors.Join(append(rollback(steps), err)...)
+			}
+			record.Moved = &Move{From: m.To, To: m.From}
+		}
+	}
+	e.appendJournal(record)
+	return last, nil
+}
+
+// Redo applies the most recently undone operation again and returns it.
+func (e *Engine) Redo() (JournalEntry, error) {
+	_, undone, err := e.stacks()
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	if len(undone) == 0 {
+		return JournalEntry{}, ErrNothingToRedo
+	}
+	last := undone[len(undone)-1]
+
+	record := JournalEntry{Op: last.Op, Redo: last.Seq, Entry: last.Entry, Moved: last.Moved}
+	if last.Backup != nil {
+		if last.Entry == nil {
+			return last, fmt.Errorf("cannot redo %s of %s", last.Op, last.Backup.Target)
+		}
+		b, err := e.resolve(*last.Entry, last.Backup.Resolution)
+		if err != nil {
+			return last, err
+		}
+		record.Backup = &b
+	} else {
+		plan, err := e.redoPlan(last.Changes)
+		if err != nil {
+			return last, err
+		}
+		if m := last.Moved; m != nil {
+			if err := moveBack(m.From, m.To); err != nil {
+				return last, err
+			}
+		}
+		res, steps := e.apply(plan)
+		if len(res.Errors) > 0 {
+			if m := last.Moved; m != nil {
+				res.Errors = append(res.Errors, move(m.To, m.From))
+			}
+			return last, errors.Join(res.Errors...)
+		}
+		record.Changes = changes(steps)
+	}
+	e.appendJournal(record)
+	return last, nil
+}
+
+// undoPlan returns the plan reverting changes, last change first.
+func (e *Engine) undoPlan(changes []Change) (Plan, error) {
+	plan := Plan{Op: "undo"}
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		a := Action{Path: c.Target, Source: c.Source, Generated: c.Generated, Mode: c.Mode}
+		var err error
+		switch c.Kind {
+		case ActionMkdir:
+			a.Kind = ActionRmdir
+		case ActionRmdir:
+			a.Kind = ActionMkdir
+		case ActionSymlink:
+			a.Kind = ActionRemove
+		case ActionRender:
+			a.Kind = ActionRemove
+			a.Content, err = written(c)
+		case ActionRemove:
+			if c.Generated {
+				a.Kind = ActionRender
+				a.Content, err = e.regenerate(c)
+			} else {
+				a.Kind, a.Relative = ActionSymlink, c.Relative
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	return plan, nil
+}
+
+// redoPlan returns the plan applying changes again.
+func (e *Engine) redoPlan(changes []Change) (Plan, error) {
+	plan := Plan{Op: "redo"}
+	for _, c := range changes {
+		a := Action{Kind: c.Kind, Path: c.Target, Source: c.Source, Relative: c.Relative, Generated: c.Generated, Mode: c.Mode}
+		var err error
+		switch {
+		case c.Kind == ActionRender:
+			a.Content, err = e.regenerate(c)
+		case c.Kind == ActionRemove && c.Generated:
+			a.Content, err = written(c)
+		}
+		if err != nil {
+			return Plan{}, err
+		}
+		plan.Actions = append(plan.Actions, a)
+	}
+	return plan, nil
+}
+
+// moveBack moves from to to, refusing to replace anything at to.
+func moveBack(from, to string) error {
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s exists, refusing to replace it with %s", to, from)
+	}
+	return move(from, to)
+}
+
+// written returns the generated file at c's target, provided it still
+// holds what the change recorded.
+func written(c Change) ([]byte, error) {
+	got, err := os.ReadFile(c.Target)
+	if err != nil {
+		return nil, err
+	}
+	if hash(got) != c.Hash {
+		return nil, fmt.Errorf("%s was edited since, refusing to remove it", c.Target)
+	}
+	return got, nil
+}
+
+// regenerate returns the output of c's source, provided it is still what
+// the change recorded.
+func (e *Engine) regenerate(c Change) ([]byte, error) {
+	content, err := e.Output(e.classify(Entry{Source: c.Source}))
+	if err != nil {
+		return nil, err
+	}
+	if hash(content) != c.Hash {
+		return nil, fmt.Errorf("%s changed since, cannot write %s again", c.Source, c.Target)
+	}
+	return content, nil
+}
+
+// changes describes applied steps for the journal.
+func changes(steps []step) []Change {
+	cs := make([]Change, 0, len(steps))
+	for _, s := range steps {
+		cs = append(cs, changeOf(s))
+	}
+	return cs
+}
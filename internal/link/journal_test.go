@@ -0,0 +1,202 @@
+package link
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func journalEngine(t *testing.T, root, home string) *Engine {
+	t.Helper()
+	p := NewPlanner(root, home)
+	p.Journal = filepath.Join(t.TempDir(), "journal.jsonl")
+	return NewEngine(p)
+}
+
+func TestUndoRedoLink(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "nvim", ".config", "nvim", "init.lua"), "")
+	e := journalEngine(t, root, home)
+	target := filepath.Join(home, ".config", "nvim", "init.lua")
+
+	if _, err := e.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Fatalf("Undo() of an empty journal = %v, want ErrNothingToUndo", err)
+	}
+	entries, err := e.Scan(filepath.Join(root, "nvim"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if res := e.Apply(e.PlanLink(entries)); len(res.Errors) > 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+
+	op, err := e.Undo()
+	if err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	if op.Op != "link" {
+		t.Errorf("Undo() reverted %q, want link", op.Op)
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".config")); !os.IsNotExist(err) {
+		t.Errorf("created directories still exist after undo: %v", err)
+	}
+	if _, err := e.Undo(); !errors.Is(err, ErrNothingToUndo) {
+		t.Errorf("second Undo() = %v, want ErrNothingToUndo", err)
+	}
+
+	if _, err := e.Redo(); err != nil {
+		t.Fatalf("Redo() unexpected error: %v", err)
+	}
+	if !isSymlinkTo(target, filepath.Join(root, "nvim", ".config", "nvim", "init.lua")) {
+		t.Errorf("%s is not linked after redo", target)
+	}
+	if _, err := e.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("second Redo() = %v, want ErrNothingToRedo", err)
+	}
+
+	// The redone link can be undone again.
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() after redo unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("link still exists after undoing the redo: %v", err)
+	}
+}
+
+func TestNewOperationClearsRedo(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "bash", ".profile"), "")
+	e := journalEngine(t, root, home)
+
+	entries, err := e.Scan(filepath.Join(root, "bash"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	if err := e.Link(entries[1]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	if _, err := e.Redo(); !errors.Is(err, ErrNothingToRedo) {
+		t.Errorf("Redo() after a new operation = %v, want ErrNothingToRedo", err)
+	}
+}
+
+func TestUndoRefusesChangedTarget(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	e := journalEngine(t, root, home)
+	target := filepath.Join(home, ".bashrc")
+
+	entries, err := e.Scan(filepath.Join(root, "bash"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+	writeFile(t, target, "mine\n")
+
+	if _, err := e.Undo(); err == nil {
+		t.Fatal("Undo() removed a file that replaced the link")
+	}
+	if got := readFile(t, target); got != "mine\n" {
+		t.Errorf("target after refused undo = %q, want it kept", got)
+	}
+}
+
+func TestUndoRedoResolve(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "bash", ".bashrc")
+	writeFile(t, src, "repo\n")
+	e := journalEngine(t, root, home)
+	target := filepath.Join(home, ".bashrc")
+	writeFile(t, target, "home\n")
+
+	entries, err := e.Scan(filepath.Join(root, "bash"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if _, err := e.Resolve(entries[0], ResolveOverwrite); err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	if got := readFile(t, target); got != "home\n" {
+		t.Errorf("target after undo = %q, want the home file back", got)
+	}
+
+	if _, err := e.Redo(); err != nil {
+		t.Fatalf("Redo() unexpected error: %v", err)
+	}
+	if !isSymlinkTo(target, src) {
+		t.Errorf("%s is not linked after redo", target)
+	}
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() of the redo unexpected error: %v", err)
+	}
+	if got := readFile(t, target); got != "home\n" {
+		t.Errorf("target after undoing the redo = %q, want the home file back", got)
+	}
+}
+
+func TestUndoRedoAdd(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	e := journalEngine(t, root, home)
+	path := filepath.Join(home, ".inputrc")
+	src := filepath.Join(root, "bash", ".inputrc")
+	writeFile(t, path, "set editing-mode vi\n")
+
+	if _, err := e.Add(filepath.Join(root, "bash"), path); err != nil {
+		t.Fatalf("Add() unexpected error: %v", err)
+	}
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("%s is not a file again after undo: %v", path, err)
+	}
+	if _, err := os.Lstat(src); !os.IsNotExist(err) {
+		t.Errorf("added file still in the package after undo: %v", err)
+	}
+
+	if _, err := e.Redo(); err != nil {
+		t.Fatalf("Redo() unexpected error: %v", err)
+	}
+	if !isSymlinkTo(path, src) || readFile(t, src) != "set editing-mode vi\n" {
+		t.Errorf("%s is not added again after redo", path)
+	}
+}
+
+func TestUndoPrune(t *testing.T) {
+	root, home := testRepo(t)
+	e := journalEngine(t, root, home)
+	link := filepath.Join(home, ".gone")
+	symlink(t, filepath.Join(root, "old", ".gone"), link)
+
+	orphans, err := e.Doctor()
+	if err != nil || len(orphans) != 1 {
+		t.Fatalf("Doctor() = %v, %v; want one orphan", orphans, err)
+	}
+	if err := e.Prune(orphans[0]); err != nil {
+		t.Fatalf("Prune() unexpected error: %v", err)
+	}
+	if _, err := e.Undo(); err != nil {
+		t.Fatalf("Undo() unexpected error: %v", err)
+	}
+	if dest, err := os.Readlink(link); err != nil || dest != filepath.Join(root, "old", ".gone") {
+		t.Errorf("pruned link after undo = %q, %v", dest, err)
+	}
+}
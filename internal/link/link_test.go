@@ -0,0 +1,295 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRefreshStatus(t *testing.T) {
+	root, home := testRepo(t)
+	p := NewPlanner(root, home)
+
+	src := filepath.Join(root, "bash", ".bashrc")
+	other := filepath.Join(root, "bash", ".profile")
+	writeFile(t, src, "export A=1")
+	writeFile(t, other, "export B=1")
+
+	tests := []struct {
+		name  string
+		setup func(target string)
+		want  Status
+	}{
+		{
+			name:  "nothing at target",
+			setup: func(string) {},
+			want:  StatusMissing,
+		},
+		{
+			name:  "absolute symlink to source",
+			setup: func(target string) { symlink(t, src, target) },
+			want:  StatusLinked,
+		},
+		{
+			name: "relative symlink to source",
+			setup: func(target string) {
+				rel, err := filepath.Rel(filepath.Dir(target), src)
+				if err != nil {
+					t.Fatalf("failed to compute relative path: %v", err)
+				}
+				symlink(t, rel, target)
+			},
+			want: StatusLinked,
+		},
+		{
+			name:  "symlink to another file",
+			setup: func(target string) { symlink(t, other, target) },
+			want:  StatusConflict,
+		},
+		{
+			name:  "regular file in the way",
+			setup: func(target string) { writeFile(t, target, "local") },
+			want:  StatusConflict,
+		},
+		{
+			name: "directory in the way",
+			setup: func(target string) {
+				if err := os.MkdirAll(target, 0o755); err != nil {
+					t.Fatalf("failed to create dir: %v", err)
+				}
+			},
+			want: StatusConflict,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(home, "case", string(rune('a'+i)), ".bashrc")
+			tt.setup(target)
+
+			got := p.Refresh(Entry{Package: "bash", Rel: ".bashrc", Source: src, Target: target})
+			if got.Status != tt.want {
+				t.Errorf("Refresh().Status = %v, want %v", got.Status, tt.want)
+			}
+			if (got.Status == StatusConflict) != (got.Reason != "") {
+				t.Errorf("Refresh().Reason = %q for status %v", got.Reason, got.Status)
+			}
+		})
+	}
+}
+
+func TestStatusText(t *testing.T) {
+	for _, st := range []Status{StatusMissing, StatusLinked, StatusConflict} {
+		text, err := st.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%v) unexpected error: %v", st, err)
+		}
+		var got Status
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) unexpected error: %v", text, err)
+		}
+		if got != st {
+			t.Errorf("round trip of %v = %v", st, got)
+		}
+	}
+
+	var st Status
+	if err := st.UnmarshalText([]byte("bogus")); err == nil {
+		t.Errorf("UnmarshalText(bogus) expected error, got nil")
+	}
+}
+
+func TestRefreshConflict(t *testing.T) {
+	root, home := testRepo(t)
+	p := NewPlanner(root, home)
+
+	src := filepath.Join(root, "bash", ".bashrc")
+	writeFile(t, src, "export A=1")
+	writeFile(t, filepath.Join(root, "bash-work", ".bashrc"), "export B=1")
+
+	tests := []struct {
+		name  string
+		setup func(target string)
+		want  Conflict
+	}{
+		{
+			name:  "linked",
+			setup: func(target string) { symlink(t, src, target) },
+			want:  ConflictNone,
+		},
+		{
+			name:  "regular file",
+			setup: func(target string) { writeFile(t, target, "local") },
+			want:  ConflictFile,
+		},
+		{
+			name: "directory",
+			setup: func(target string) {
+				if err := os.MkdirAll(target, 0o755); err != nil {
+					t.Fatalf("failed to create dir: %v", err)
+				}
+			},
+			want: ConflictDir,
+		},
+		{
+			name:  "another package",
+			setup: func(target string) { symlink(t, filepath.Join(root, "bash-work", ".bashrc"), target) },
+			want:  ConflictPackage,
+		},
+		{
+			name:  "outside the repo",
+			setup: func(target string) { symlink(t, "/somewhere/else", target) },
+			want:  ConflictForeign,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(home, string(rune('a'+i)), ".bashrc")
+			tt.setup(target)
+
+			got := p.Refresh(Entry{Package: "bash", Rel: ".bashrc", Source: src, Target: target})
+			if got.Conflict != tt.want {
+				t.Errorf("Refresh().Conflict = %v, want %v (%s)", got.Conflict, tt.want, got.Reason)
+			}
+			if (got.Status == StatusConflict) != (got.Conflict != ConflictNone) {
+				t.Errorf("Refresh() = %v with conflict %v", got.Status, got.Conflict)
+			}
+		})
+	}
+
+	t.Run("permission denied", func(t *testing.T) {
+		if os.Geteuid() == 0 {
+			t.Skip("root ignores directory permissions")
+		}
+		dir := filepath.Join(home, "locked")
+		writeFile(t, filepath.Join(dir, ".bashrc"), "")
+		if err := os.Chmod(dir, 0); err != nil {
+			t.Fatalf("failed to chmod: %v", err)
+		}
+		t.Cleanup(func() { os.Chmod(dir, 0o755) })
+
+		got := p.Refresh(Entry{Source: src, Target: filepath.Join(dir, ".bashrc")})
+		if got.Conflict != ConflictUnreadable {
+			t.Errorf("Refresh().Conflict = %v, want %v", got.Conflict, ConflictUnreadable)
+		}
+	})
+}
+
+func TestConflictResolutions(t *testing.T) {
+	if got := ConflictFile.Resolutions(); !slices.Contains(got, ResolveAdopt) {
+		t.Errorf("ConflictFile.Resolutions() = %v, want adopt included", got)
+	}
+	for _, c := range []Conflict{ConflictDir, ConflictPackage, ConflictForeign} {
+		if got := c.Resolutions(); slices.Contains(got, ResolveAdopt) || !slices.Contains(got, ResolveBackup) {
+			t.Errorf("%v.Resolutions() = %v, want backup but not adopt", c, got)
+		}
+	}
+	if got := ConflictUnreadable.Resolutions(); len(got) != 0 {
+		t.Errorf("ConflictUnreadable.Resolutions() = %v, want none", got)
+	}
+}
+
+func TestEngineLink(t *testing.T) {
+	root, home := testRepo(t)
+
+	src := filepath.Join(root, "nvim", ".config", "nvim", "init.lua")
+	writeFile(t, src, "-- nvim")
+	writeFile(t, filepath.Join(root, "git", ".gitconfig"), "[user]")
+	writeFile(t, filepath.Join(root, "tmux", ".tmux.conf"), "")
+	e := NewEngine(NewPlanner(root, home))
+	entry := func(pkg string) Entry { return scan(t, e, filepath.Join(root, pkg))[0] }
+
+	t.Run("creates parents and symlink", func(t *testing.T) {
+		target := filepath.Join(home, ".config", "nvim", "init.lua")
+		if err := e.Link(entry("nvim")); err != nil {
+			t.Fatalf("Link() unexpected error: %v", err)
+		}
+		if !isSymlinkTo(target, src) {
+			t.Errorf("Link() did not create symlink to %s", src)
+		}
+	})
+
+	t.Run("already linked is a no-op", func(t *testing.T) {
+		if err := e.Link(entry("nvim")); err != nil {
+			t.Errorf("Link() on linked target unexpected error: %v", err)
+		}
+	})
+
+	t.Run("refuses to replace regular file", func(t *testing.T) {
+		target := filepath.Join(home, ".gitconfig")
+		writeFile(t, target, "local")
+		if err := e.Link(entry("git")); err == nil {
+			t.Errorf("Link() expected error for existing file, got nil")
+		}
+		if data, _ := os.ReadFile(target); string(data) != "local" {
+			t.Errorf("Link() modified existing file, got %q", data)
+		}
+	})
+
+	t.Run("refuses to replace foreign symlink", func(t *testing.T) {
+		symlink(t, "/somewhere/else", filepath.Join(home, ".tmux.conf"))
+		if err := e.Link(entry("tmux")); err == nil {
+			t.Errorf("Link() expected error for foreign symlink, got nil")
+		}
+	})
+}
+
+func TestEngineUnlink(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(src, target string)
+		wantErr  bool
+		wantGone bool
+	}{
+		{
+			name:     "removes symlink to source",
+			setup:    func(src, target string) { symlink(t, src, target) },
+			wantGone: true,
+		},
+		{
+			name:     "missing target is a no-op",
+			setup:    func(string, string) {},
+			wantGone: true,
+		},
+		{
+			name:    "refuses regular file",
+			setup:   func(_, target string) { writeFile(t, target, "local") },
+			wantErr: true,
+		},
+		{
+			name:    "refuses symlink pointing elsewhere",
+			setup:   func(_, target string) { symlink(t, "/somewhere/else", target) },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, home := testRepo(t)
+			src := filepath.Join(root, "git", ".gitconfig")
+			target := filepath.Join(home, ".gitconfig")
+			writeFile(t, src, "[user]")
+			tt.setup(src, target)
+			e := NewEngine(NewPlanner(root, home))
+
+			err := e.Unlink(scan(t, e, filepath.Join(root, "git"))[0])
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Unlink() expected error, got nil")
+				}
+				if _, statErr := os.Lstat(target); statErr != nil {
+					t.Errorf("Unlink() removed target on error: %v", statErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unlink() unexpected error: %v", err)
+			}
+			if _, statErr := os.Lstat(target); tt.wantGone && !os.IsNotExist(statErr) {
+				t.Errorf("Unlink() left target in place")
+			}
+		})
+	}
+}
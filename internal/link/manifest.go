@@ -0,0 +1,191 @@
+package link
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+)
+
+// ManifestFile is the optional per-package manifest. It is never linked.
+const ManifestFile = "lazydots.json"
+
+// goos is the operating system packages are checked against.
+var goos = runtime.GOOS
+
+// Manifest describes a package and how it relates to others.
+type Manifest struct {
+	Description string   `json:"description,omitempty"`
+	Requires    []string `json:"requires,omitempty"`   // packages linked along with this one
+	Conflicts   []string `json:"conflicts,omitempty"`  // packages that can't be linked at the same time
+	OS          []string `json:"os,omitempty"`         // supported GOOS values, e.g. "linux"; empty means all
+	Secrets     []string `json:"secrets,omitempty"`    // age-encrypted files without the .age suffix, relative to the package
+	Copy        []string `json:"copy,omitempty"`       // files (or directories) copied instead of linked, relative to the package
+	Recipients  []string `json:"recipients,omitempty"` // age recipients (age1...) adopted secrets are encrypted to besides the identity
+}
+
+// ReadManifest reads the manifest of the package at pkgPath. A package
+// without one has an empty manifest.
+func ReadManifest(pkgPath string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(pkgPath, ManifestFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, fmt.Errorf("invalid %s in %s: %w", ManifestFile, filepath.Base(pkgPath), err)
+	}
+	return m, nil
+}
+
+// manifestLists reports whether the package file src is in the list that
+// pick returns from its package's manifest, itself or through a listed
+// directory.
+func (p *Planner) manifestLists(src string, pick func(Manifest) []string) bool {
+	pkg := packageOf(p.Root, src)
+	if pkg == "" {
+		return false
+	}
+	pkgPath := filepath.Join(p.Root, pkg)
+	m, err := ReadManifest(pkgPath)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(pkgPath, src)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return slices.ContainsFunc(pick(m), func(path string) bool {
+		path = strings.TrimSuffix(path, "/")
+		return rel == path || strings.HasPrefix(rel, path+"/")
+	})
+}
+
+// Supports reports whether the package can be linked on goos.
+func (m Manifest) Supports(goos string) bool {
+	return len(m.OS) == 0 || slices.Contains(m.OS, goos)
+}
+
+// PackagesToLink returns the packages to link for the packages called
+// names: each one's requirements, recursively, come before it. It refuses
+// unknown packages, requirement cycles, packages that don't support this
+// OS, and packages that conflict with each other or with a package that is
+// already linked.
+func (p *Planner) PackagesToLink(names []string) ([]Package, error) {
+	return p.packagesToLink(names, true)
+}
+
+// packagesToLink implements PackagesToLink. Conflicts with linked packages
+// outside the set are only checked if checkLinked is set.
+func (p *Planner) packagesToLink(names []string, checkLinked bool) ([]Package, error) {
+	pkgs, err := Packages(p.Root)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]Package{}
+	for _, pkg := range pkgs {
+		byName[pkg.Name] = pkg
+	}
+	manifests := map[string]Manifest{}
+	manifest := func(name string) (Manifest, error) {
+		if m, ok := manifests[name]; ok {
+			return m, nil
+		}
+		m, err := ReadManifest(byName[name].Path)
+		manifests[name] = m
+		return m, err
+	}
+
+	var order []Package
+	done := map[string]bool{}
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		if slices.Contains(path, name) {
+			return fmt.Errorf("requirement cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		pkg, ok := byName[name]
+		if !ok {
+			if len(path) > 0 {
+				return fmt.Errorf("package %s requires unknown package %s", path[len(path)-1], name)
+			}
+			return fmt.Errorf("unknown package %s", name)
+		}
+		m, err := manifest(name)
+		if err != nil {
+			return err
+		}
+		if !m.Supports(goos) {
+			return fmt.Errorf("package %s does not support %s (only %s)", name, goos, strings.Join(m.OS, ", "))
+		}
+		for _, req := range m.Requires {
+			if err := visit(req, append(path, name)); err != nil {
+				return err
+			}
+		}
+		done[name] = true
+		order = append(order, pkg)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// Conflicts count whichever package declares them.
+	for _, pkg := range order {
+		m, _ := manifest(pkg.Name)
+		for _, other := range order {
+			if slices.Contains(m.Conflicts, other.Name) {
+				return nil, fmt.Errorf("package %s conflicts with %s", pkg.Name, other.Name)
+			}
+		}
+	}
+	if !checkLinked {
+		return order, nil
+	}
+	for _, other := range pkgs {
+		if done[other.Name] {
+			continue
+		}
+		om, err := manifest(other.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, pkg := range order {
+			m, _ := manifest(pkg.Name)
+			if !slices.Contains(m.Conflicts, other.Name) && !slices.Contains(om.Conflicts, pkg.Name) {
+				continue
+			}
+			linked, err := p.Linked(other.Path)
+			if err != nil {
+				return nil, err
+			}
+			if linked {
+				return nil, fmt.Errorf("package %s conflicts with %s, which is linked; unlink it first", pkg.Name, other.Name)
+			}
+		}
+	}
+	return order, nil
+}
+
+// Linked reports whether any file of the package at pkgPath is linked.
+func (p *Planner) Linked(pkgPath string) (bool, error) {
+	entries, err := p.Scan(pkgPath)
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(entries, func(e Entry) bool { return e.Status == StatusLinked }), nil
+}
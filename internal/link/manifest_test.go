@@ -0,0 +1,103 @@
+package link
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	root, _ := testRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, ManifestFile), `{"description": "Neovim", "requires": ["git"], "os": ["linux", "darwin"]}`)
+
+	m, err := ReadManifest(pkg)
+	if err != nil {
+		t.Fatalf("ReadManifest() unexpected error: %v", err)
+	}
+	if m.Description != "Neovim" || len(m.Requires) != 1 || !m.Supports("linux") || m.Supports("windows") {
+		t.Errorf("ReadManifest() = %+v", m)
+	}
+
+	if m, err := ReadManifest(filepath.Join(root, "none")); err != nil || m.Description != "" {
+		t.Errorf("ReadManifest() without a manifest = %+v, %v; want empty", m, err)
+	}
+
+	writeFile(t, filepath.Join(root, "bad", ManifestFile), "{")
+	if _, err := ReadManifest(filepath.Join(root, "bad")); err == nil {
+		t.Error("ReadManifest() of invalid JSON expected error, got nil")
+	}
+}
+
+func TestManifestNotLinked(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ManifestFile), `{}`)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig"), "")
+
+	entries, err := NewPlanner(root, home).Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Rel != ".gitconfig" {
+		t.Errorf("Scan() = %+v, want only .gitconfig", entries)
+	}
+}
+
+func TestPackagesToLink(t *testing.T) {
+	root, home := testRepo(t)
+	for pkg, manifest := range map[string]string{
+		"git":          `{}`,
+		"shell":        `{"requires": ["git"]}`,
+		"nvim":         `{"requires": ["shell", "git"]}`,
+		"bash":         `{"conflicts": ["bash-minimal"]}`,
+		"bash-minimal": `{}`,
+		"macos":        `{"os": ["plan9"]}`,
+		"loop-a":       `{"requires": ["loop-b"]}`,
+		"loop-b":       `{"requires": ["loop-a"]}`,
+		"broken":       `{"requires": ["nope"]}`,
+	} {
+		writeFile(t, filepath.Join(root, pkg, ManifestFile), manifest)
+		writeFile(t, filepath.Join(root, pkg, "."+pkg+"rc"), "")
+	}
+	p := NewPlanner(root, home)
+
+	got, err := p.PackagesToLink([]string{"nvim"})
+	if err != nil {
+		t.Fatalf("PackagesToLink(nvim) unexpected error: %v", err)
+	}
+	var names []string
+	for _, pkg := range got {
+		names = append(names, pkg.Name)
+	}
+	if strings.Join(names, " ") != "git shell nvim" {
+		t.Errorf("PackagesToLink(nvim) = %v, want [git shell nvim]", names)
+	}
+
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{names: []string{"bash", "bash-minimal"}, want: "conflicts with bash-minimal"},
+		{names: []string{"bash-minimal", "bash"}, want: "conflicts with bash-minimal"},
+		{names: []string{"macos"}, want: "does not support"},
+		{names: []string{"loop-a"}, want: "cycle"},
+		{names: []string{"broken"}, want: "unknown package nope"},
+		{names: []string{"missing"}, want: "unknown package missing"},
+	}
+	for _, tt := range tests {
+		if _, err := p.PackagesToLink(tt.names); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("PackagesToLink(%v) = %v, want error containing %q", tt.names, err, tt.want)
+		}
+	}
+
+	// A conflicting package that is already linked is refused too, from
+	// either side.
+	symlink(t, filepath.Join(root, "bash-minimal", ".bash-minimalrc"), filepath.Join(home, ".bash-minimalrc"))
+	if _, err := p.PackagesToLink([]string{"bash"}); err == nil || !strings.Contains(err.Error(), "unlink it first") {
+		t.Errorf("PackagesToLink(bash) with bash-minimal linked = %v, want a conflict", err)
+	}
+	symlink(t, filepath.Join(root, "bash", ".bashrc"), filepath.Join(home, ".bashrc"))
+	if _, err := p.PackagesToLink([]string{"bash-minimal"}); err == nil {
+		t.Error("PackagesToLink(bash-minimal) with bash linked expected a conflict, got nil")
+	}
+}
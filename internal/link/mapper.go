@@ -0,0 +1,116 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TargetMapper maps a file inside a package to its target path.
+type TargetMapper interface {
+	// Map returns the path below the target directory for rel, a path
+	// relative to the package directory.
+	Map(rel string) string
+
+	// Unmap is the inverse of Map: it returns the path inside a package
+	// that maps to targetRel, or false if there is none.
+	Unmap(targetRel string) (string, bool)
+}
+
+// StowMapper maps package contents 1:1 onto the target directory, like
+// GNU Stow: "nvim/init.lua" -> "~/nvim/init.lua".
+type StowMapper struct{}
+
+func (StowMapper) Map(rel string) string {
+	return filepath.Clean(rel)
+}
+
+func (StowMapper) Unmap(targetRel string) (string, bool) {
+	return filepath.Clean(targetRel), true
+}
+
+// LegacyMapper is the mapping used by earlier versions of lazydots. The
+// first path segment is stripped unless it starts with ".":
+//
+//	".config/fish/config.fish" -> "~/.config/fish/config.fish"
+//	"nvim/init.lua"            -> "~/init.lua"
+type LegacyMapper struct{}
+
+func (LegacyMapper) Map(rel string) string {
+	rel = filepath.Clean(rel)
+	if !strings.HasPrefix(rel, ".") {
+		if i := strings.IndexRune(rel, os.PathSeparator); i != -1 {
+			rel = rel[i+1:]
+		}
+	}
+	return rel
+}
+
+// Unmap keeps targetRel as is when that maps back onto itself. Other paths
+// (like "nvim/init.lua", which would need an extra leading directory) have
+// no single inverse.
+func (m LegacyMapper) Unmap(targetRel string) (string, bool) {
+	rel := filepath.Clean(targetRel)
+	return rel, m.Map(rel) == rel
+}
+
+// DotPrefix is the file name prefix DotfilesMapper turns into ".".
+const DotPrefix = "dot-"
+
+// DotfilesMapper implements GNU Stow's --dotfiles option: every path
+// segment starting with "dot-" is renamed to start with "." before Mapper
+// is applied, so "dot-config/fish/dot-env" -> "~/.config/fish/.env".
+type DotfilesMapper struct {
+	Mapper TargetMapper // mapping applied after renaming; nil means StowMapper
+}
+
+func (m DotfilesMapper) Map(rel string) string {
+	parts := strings.Split(filepath.Clean(rel), string(os.PathSeparator))
+	for i, part := range parts {
+		if strings.HasPrefix(part, DotPrefix) && len(part) > len(DotPrefix) {
+			parts[i] = "." + strings.TrimPrefix(part, DotPrefix)
+		}
+	}
+	return m.inner().Map(filepath.Join(parts...))
+}
+
+// Unmap renames every segment of the unmapped path starting with "." to
+// start with "dot-".
+func (m DotfilesMapper) Unmap(targetRel string) (string, bool) {
+	rel, ok := m.inner().Unmap(targetRel)
+	if !ok {
+		return "", false
+	}
+	parts := strings.Split(rel, string(os.PathSeparator))
+	for i, part := range parts {
+		if strings.HasPrefix(part, ".") && part != "." && part != ".." {
+			parts[i] = DotPrefix + strings.TrimPrefix(part, ".")
+		}
+	}
+	return filepath.Join(parts...), true
+}
+
+func (m DotfilesMapper) inner() TargetMapper {
+	if m.Mapper == nil {
+		return StowMapper{}
+	}
+	return m.Mapper
+}
+
+// Mapper names accepted by MapperFor and the "mapping" config key.
+const (
+	MappingStow   = "stow"
+	MappingLegacy = "legacy"
+)
+
+// MapperFor returns the TargetMapper called name. An empty name selects
+// the default stow mapping.
+func MapperFor(name string) (TargetMapper, bool) {
+	switch name {
+	case "", MappingStow:
+		return StowMapper{}, true
+	case MappingLegacy:
+		return LegacyMapper{}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,187 @@
+package link
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStowMapper(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{rel: ".bashrc", want: ".bashrc"},
+		{rel: ".config/fish/config.fish", want: ".config/fish/config.fish"},
+		{rel: "nvim/init.lua", want: "nvim/init.lua"},
+		{rel: "bin/backup", want: "bin/backup"},
+		{rel: "notes.txt", want: "notes.txt"},
+		{rel: "./.profile", want: ".profile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			got := StowMapper{}.Map(filepath.FromSlash(tt.rel))
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("Map(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyMapper(t *testing.T) {
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{rel: ".bashrc", want: ".bashrc"},
+		{rel: ".config/fish/config.fish", want: ".config/fish/config.fish"},
+		{rel: "nvim/init.lua", want: "init.lua"},
+		{rel: "FEDORA/.config/kitty/kitty.conf", want: ".config/kitty/kitty.conf"},
+		{rel: "notes.txt", want: "notes.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			got := LegacyMapper{}.Map(filepath.FromSlash(tt.rel))
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("Map(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDotfilesMapper(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper TargetMapper
+		rel    string
+		want   string
+	}{
+		{name: "file", rel: "dot-bashrc", want: ".bashrc"},
+		{name: "nested", rel: "dot-config/fish/dot-env", want: ".config/fish/.env"},
+		{name: "already hidden", rel: ".profile", want: ".profile"},
+		{name: "no prefix", rel: "bin/dotfiles-sync", want: "bin/dotfiles-sync"},
+		{name: "prefix only", rel: "dot-", want: "dot-"},
+		{name: "prefix inside name", rel: "my-dot-file", want: "my-dot-file"},
+		{name: "legacy keeps renamed segment", mapper: LegacyMapper{}, rel: "dot-config/kitty/kitty.conf", want: ".config/kitty/kitty.conf"},
+		{name: "legacy strips package dir", mapper: LegacyMapper{}, rel: "kitty/dot-kitty.conf", want: ".kitty.conf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DotfilesMapper{Mapper: tt.mapper}.Map(filepath.FromSlash(tt.rel))
+			if got != filepath.FromSlash(tt.want) {
+				t.Errorf("Map(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapperFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   TargetMapper
+		wantOK bool
+	}{
+		{name: "", want: StowMapper{}, wantOK: true},
+		{name: "stow", want: StowMapper{}, wantOK: true},
+		{name: "legacy", want: LegacyMapper{}, wantOK: true},
+		{name: "chezmoi", want: nil, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MapperFor(tt.name)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("MapperFor(%q) = %v, %v, want %v, %v", tt.name, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestPlannerMapper(t *testing.T) {
+	root, home := testRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, "nvim", "init.lua"), "")
+
+	tests := []struct {
+		name   string
+		mapper TargetMapper
+		want   string
+	}{
+		{name: "default", mapper: nil, want: filepath.Join(home, "nvim", "init.lua")},
+		{name: "stow", mapper: StowMapper{}, want: filepath.Join(home, "nvim", "init.lua")},
+		{name: "legacy", mapper: LegacyMapper{}, want: filepath.Join(home, "init.lua")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPlanner(root, home)
+			p.Mapper = tt.mapper
+			entries, err := p.Scan(pkg)
+			if err != nil {
+				t.Fatalf("Scan() unexpected error: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Target != tt.want {
+				t.Errorf("Scan() = %+v, want target %q", entries, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinkDotfiles(t *testing.T) {
+	root, home := testRepo(t)
+	pkg := filepath.Join(root, "bash")
+	writeFile(t, filepath.Join(pkg, "dot-bashrc"), "")
+	writeFile(t, filepath.Join(pkg, "dot-config", "bash", "aliases"), "")
+
+	p := NewPlanner(root, home)
+	p.Mapper = DotfilesMapper{}
+	p.Fold = true
+	e := NewEngine(p)
+
+	if res := e.Apply(e.PlanLink(scan(t, e, pkg))); len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+	if !isSymlinkTo(filepath.Join(home, ".bashrc"), filepath.Join(pkg, "dot-bashrc")) {
+		t.Errorf("~/.bashrc is not linked to dot-bashrc")
+	}
+	if !isSymlinkTo(filepath.Join(home, ".config"), filepath.Join(pkg, "dot-config")) {
+		t.Errorf("~/.config is not folded onto dot-config")
+	}
+	for _, entry := range scan(t, e, pkg) {
+		if entry.Status != StatusLinked {
+			t.Errorf("%s status = %v, want linked", entry.Rel, entry.Status)
+		}
+	}
+}
+
+func TestUnmap(t *testing.T) {
+	tests := []struct {
+		name   string
+		mapper TargetMapper
+		target string
+		want   string
+		wantOK bool
+	}{
+		{name: "stow", mapper: StowMapper{}, target: ".config/foo/bar.conf", want: ".config/foo/bar.conf", wantOK: true},
+		{name: "stow plain", mapper: StowMapper{}, target: "bin/tool", want: "bin/tool", wantOK: true},
+		{name: "legacy hidden", mapper: LegacyMapper{}, target: ".config/foo/bar.conf", want: ".config/foo/bar.conf", wantOK: true},
+		{name: "legacy top level", mapper: LegacyMapper{}, target: "notes.txt", want: "notes.txt", wantOK: true},
+		{name: "legacy ambiguous", mapper: LegacyMapper{}, target: "bin/tool", wantOK: false},
+		{name: "dotfiles", mapper: DotfilesMapper{}, target: ".config/fish/.env", want: "dot-config/fish/dot-env", wantOK: true},
+		{name: "dotfiles plain", mapper: DotfilesMapper{}, target: "bin/tool", want: "bin/tool", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.mapper.Unmap(filepath.FromSlash(tt.target))
+			if ok != tt.wantOK || (ok && got != filepath.FromSlash(tt.want)) {
+				t.Errorf("Unmap(%q) = %q, %v, want %q, %v", tt.target, got, ok, tt.want, tt.wantOK)
+			}
+			if ok && tt.mapper.Map(got) != filepath.FromSlash(tt.target) {
+				t.Errorf("Map(Unmap(%q)) = %q, want the target back", tt.target, tt.mapper.Map(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package link
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// Generated reports whether e's target is written from its source, as a
+// rendered template, a decrypted secret or a copy, rather than linked.
+func (e Entry) Generated() bool {
+	return e.Template || e.Secret || e.Copy
+}
+
+// Output returns what is written to the target of the generated entry e:
+// its decrypted secret, its rendered template or a copy of its source.
+func (p *Planner) Output(e Entry) ([]byte, error) {
+	switch {
+	case e.Secret:
+		return p.Decrypt(e.Source)
+	case e.Template:
+		return p.Render(e.Source)
+	}
+	return os.ReadFile(e.Source)
+}
+
+// outputError is the conflict for a generated entry whose output can't be
+// produced.
+func outputError(e Entry, err error) state {
+	switch {
+	case e.Secret:
+		return conflict(ConflictSecret, fmt.Sprintf("cannot decrypt: %v", err))
+	case e.Template:
+		return conflict(ConflictTemplate, fmt.Sprintf("template error: %v", err))
+	}
+	return conflict(ConflictUnreadable, fmt.Sprintf("read failed: %v", err))
+}
+
+// inspectOutput is inspect for generated entries: a regular file at the
+// target counts as linked if it matches the entry's output.
+func (p *Planner) inspectOutput(e Entry) state {
+	info, err := os.Lstat(e.Target)
+	if os.IsNotExist(err) {
+		return state{status: StatusMissing}
+	}
+	if err != nil {
+		return conflict(ConflictUnreadable, fmt.Sprintf("lstat failed: %v", err))
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		dest, err := readLink(e.Target)
+		if err != nil {
+			return conflict(ConflictUnreadable, fmt.Sprintf("readlink failed: %v", err))
+		}
+		if packageOf(p.Root, dest) != "" {
+			return conflict(ConflictPackage, linkedElsewhere(p.Root, dest))
+		}
+		return conflict(ConflictForeign, linkedElsewhere(p.Root, dest))
+	case info.IsDir():
+		return conflict(ConflictDir, "a directory is in the way")
+	}
+
+	want, err := p.Output(e)
+	if err != nil {
+		return outputError(e, err)
+	}
+	got, err := os.ReadFile(e.Target)
+	if err != nil {
+		return conflict(ConflictUnreadable, fmt.Sprintf("read failed: %v", err))
+	}
+	if !bytes.Equal(got, want) {
+		return p.outOfSync(e, got, want)
+	}
+	return state{status: StatusLinked}
+}
+
+// outOfSync explains why the generated target of e holds got rather than
+// its output want, using the record of what was last written to it: only
+// the source changed (stale), or the target was edited (drift).
+func (p *Planner) outOfSync(e Entry, got, want []byte) state {
+	source, verb := "package file", "copied"
+	switch {
+	case e.Secret:
+		source, verb = "secret", "decrypted"
+	case e.Template:
+		source, verb = "template", "rendered"
+	}
+	last, ok := p.synced()[e.Target]
+	switch {
+	case !ok:
+		return conflict(ConflictDrift, "target differs from its "+source)
+	case hash(got) == last:
+		return conflict(ConflictStale, source+" changed since the target was "+verb)
+	case hash(want) == last:
+		return conflict(ConflictDrift, "target modified since it was "+verb)
+	}
+	return conflict(ConflictDrift, "target and "+source+" both changed since it was "+verb)
+}
+
+// state returns what is at e's target, dispatching to inspectOutput for
+// generated entries.
+func (p *Planner) state(e Entry) state {
+	if e.Generated() {
+		return p.inspectOutput(e)
+	}
+	st := inspect(p.Root, e.Source, e.Target)
+	if st.conflict == ConflictFile {
+		return p.replacedLink(e, st)
+	}
+	return st
+}
+
+// outputMode returns the permissions a generated entry's target is
+// written with: a secret is only readable by its owner, anything else gets
+// its source's permissions.
+func outputMode(e Entry) os.FileMode {
+	if e.Secret {
+		return 0o600
+	}
+	if info, err := os.Stat(e.Source); err == nil {
+		return info.Mode().Perm()
+	}
+	return 0o644
+}
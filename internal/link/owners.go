@@ -0,0 +1,115 @@
+package link
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Owners indexes the repository by target path: every target maps to the
+// package entries that claim it. A target claimed by more than one package
+// can only ever be linked to one of them.
+type Owners map[string][]Entry
+
+// Owners scans every package in the repository and indexes its entries by
+// target path.
+func (p *Planner) Owners() (Owners, error) {
+	pkgs, err := Packages(p.Root)
+	if err != nil {
+		return nil, err
+	}
+	o := Owners{}
+	for _, pkg := range pkgs {
+		entries, err := p.Scan(pkg.Path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			o[e.Target] = append(o[e.Target], e)
+		}
+	}
+	return o, nil
+}
+
+// Claims returns the names of the packages claiming target, in order.
+func (o Owners) Claims(target string) []string {
+	var names []string
+	for _, e := range o[target] {
+		if !slices.Contains(names, e.Package) {
+			names = append(names, e.Package)
+		}
+	}
+	return names
+}
+
+// Owner returns the package target is currently linked to, or "" if it
+// isn't linked to any of the packages claiming it.
+func (o Owners) Owner(target string) string {
+	for _, e := range o[target] {
+		if e.Status == StatusLinked {
+			return e.Package
+		}
+	}
+	return ""
+}
+
+// Overlaps returns, for every package sharing at least one target with
+// another package, the sorted names of those other packages.
+func (o Owners) Overlaps() map[string][]string {
+	overlaps := map[string][]string{}
+	for target := range o {
+		names := o.Claims(target)
+		if len(names) < 2 {
+			continue
+		}
+		for _, name := range names {
+			for _, other := range names {
+				if other != name && !slices.Contains(overlaps[name], other) {
+					overlaps[name] = append(overlaps[name], other)
+				}
+			}
+		}
+	}
+	for _, others := range overlaps {
+		sort.Strings(others)
+	}
+	return overlaps
+}
+
+// Shared returns the targets that the package name shares with other
+// packages, sorted.
+func (o Owners) Shared(name string) []string {
+	var targets []string
+	for target := range o {
+		names := o.Claims(target)
+		if len(names) > 1 && slices.Contains(names, name) {
+			targets = append(targets, target)
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// packageOf returns the name of the package below root that dest is in, or
+// "" if dest isn't inside one.
+func packageOf(root, dest string) string {
+	if root == "" || !within(dest, root) {
+		return ""
+	}
+	rel, err := filepath.Rel(root, dest)
+	if err != nil || rel == "." {
+		return ""
+	}
+	pkg, _, _ := strings.Cut(filepath.ToSlash(rel), "/")
+	return pkg
+}
+
+// linkedElsewhere explains a conflict with a symlink to dest, naming the
+// package that owns the target when dest is inside the repository at root.
+func linkedElsewhere(root, dest string) string {
+	if pkg := packageOf(root, dest); pkg != "" {
+		return "already linked by package " + pkg + ": " + dest
+	}
+	return "symlink points to " + dest
+}
@@ -0,0 +1,71 @@
+package link
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOwners(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "bash", ".profile"), "")
+	writeFile(t, filepath.Join(root, "bash-work", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "zsh", ".profile"), "")
+	writeFile(t, filepath.Join(root, "git", ".gitconfig"), "")
+	symlink(t, filepath.Join(root, "bash-work", ".bashrc"), filepath.Join(home, ".bashrc"))
+
+	p := NewPlanner(root, home)
+	o, err := p.Owners()
+	if err != nil {
+		t.Fatalf("Owners() unexpected error: %v", err)
+	}
+
+	bashrc := filepath.Join(home, ".bashrc")
+	if got := o.Claims(bashrc); !reflect.DeepEqual(got, []string{"bash", "bash-work"}) {
+		t.Errorf("Claims(.bashrc) = %v, want [bash bash-work]", got)
+	}
+	if got := o.Owner(bashrc); got != "bash-work" {
+		t.Errorf("Owner(.bashrc) = %q, want bash-work", got)
+	}
+	if got := o.Owner(filepath.Join(home, ".profile")); got != "" {
+		t.Errorf("Owner(.profile) = %q, want none", got)
+	}
+
+	want := map[string][]string{
+		"bash":      {"bash-work", "zsh"},
+		"bash-work": {"bash"},
+		"zsh":       {"bash"},
+	}
+	if got := o.Overlaps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Overlaps() = %v, want %v", got, want)
+	}
+	if got := o.Shared("bash"); !reflect.DeepEqual(got, []string{bashrc, filepath.Join(home, ".profile")}) {
+		t.Errorf("Shared(bash) = %v", got)
+	}
+	if got := o.Shared("git"); len(got) != 0 {
+		t.Errorf("Shared(git) = %v, want none", got)
+	}
+}
+
+func TestPlanLinkNamesOwner(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "bash-work", ".bashrc"), "")
+	symlink(t, filepath.Join(root, "bash-work", ".bashrc"), filepath.Join(home, ".bashrc"))
+
+	p := NewPlanner(root, home)
+	entries, err := p.Scan(filepath.Join(root, "bash"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if !strings.Contains(entries[0].Reason, "package bash-work") {
+		t.Errorf("Scan() reason = %q, want it to name bash-work", entries[0].Reason)
+	}
+
+	plan := p.PlanLink(entries)
+	if len(plan.Actions) != 1 || !strings.Contains(plan.Actions[0].Reason, "package bash-work") {
+		t.Errorf("PlanLink() = %+v, want a skip naming bash-work", plan.Actions)
+	}
+}
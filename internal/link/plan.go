@@ -0,0 +1,165 @@
+package link
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ActionKind is the kind of filesystem change an Action makes.
+type ActionKind int
+
+const (
+	ActionMkdir   ActionKind = iota // create a directory
+	ActionSymlink                   // create a symlink at Path pointing to Source
+	ActionRemove                    // remove the symlink at Path
+	ActionSkip                      // leave Path alone because of a conflict
+	ActionRender                    // write the output of Source, a template or secret, to Path
+	ActionRmdir                     // remove the directory at Path if it is empty, when undoing
+)
+
+func (k ActionKind) String() string {
+	switch k {
+	case ActionMkdir:
+		return "mkdir"
+	case ActionSymlink:
+		return "symlink"
+	case ActionRemove:
+		return "remove"
+	case ActionSkip:
+		return "skip"
+	case ActionRender:
+		return "render"
+	case ActionRmdir:
+		return "rmdir"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the kind as its name, e.g. "symlink".
+func (k ActionKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind name produced by MarshalText.
+func (k *ActionKind) UnmarshalText(text []byte) error {
+	for _, kind := range []ActionKind{ActionMkdir, ActionSymlink, ActionRemove, ActionSkip, ActionRender, ActionRmdir} {
+		if kind.String() == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown action %q", text)
+}
+
+// Action is a single step of a Plan.
+type Action struct {
+	Kind   ActionKind
+	Path   string // directory or target path the action changes
+	Source string // file inside the repo (symlink, remove and skip actions)
+	Rel    string // entry (or folded directory) path relative to its package
+	Reason string // why the entry is skipped
+	Count  int    // package entries linked or unlinked by this action
+
+	Relative bool // create the symlink with a path relative to its directory
+
+	Generated bool        // write (or remove) a generated file instead of a symlink
+	Content   []byte      // rendered template or decrypted secret, for generated files
+	Mode      os.FileMode // permissions of a written file or created directory
+}
+
+func (a Action) String() string {
+	switch a.Kind {
+	case ActionSymlink:
+		return fmt.Sprintf("%-7s %s -> %s", a.Kind, a.Path, linkText(a))
+	case ActionSkip:
+		return fmt.Sprintf("%-7s %s (%s)", a.Kind, a.Path, a.Reason)
+	case ActionRender:
+		return fmt.Sprintf("%-7s %s <- %s", a.Kind, a.Path, a.Source)
+	}
+	return fmt.Sprintf("%-7s %s", a.Kind, a.Path)
+}
+
+// Plan is the ordered list of actions a batch operation will perform.
+// Nothing on disk changes until the plan is applied with Engine.Apply.
+type Plan struct {
+	Op        string // what the plan does, e.g. "link", as recorded in the journal
+	Actions   []Action
+	Unchanged int // entries already in the requested state
+}
+
+// Changes returns the number of actions that modify the filesystem.
+func (p Plan) Changes() int {
+	n := 0
+	for _, a := range p.Actions {
+		if a.Kind != ActionSkip {
+			n++
+		}
+	}
+	return n
+}
+
+// Conflicts returns the number of entries skipped because of a conflict.
+func (p Plan) Conflicts() int {
+	return len(p.Actions) - p.Changes()
+}
+
+// WithRelative returns a copy of p whose symlinks are all created relative
+// (or all absolute), overriding the planner's setting.
+func (p Plan) WithRelative(relative bool) Plan {
+	actions := make([]Action, len(p.Actions))
+	for i, a := range p.Actions {
+		if a.Kind == ActionSymlink {
+			a.Relative = relative
+		}
+		actions[i] = a
+	}
+	p.Actions = actions
+	return p
+}
+
+func (p Plan) String() string {
+	var b strings.Builder
+	for _, a := range p.Actions {
+		b.WriteString(a.String())
+		b.WriteByte('\n')
+	}
+	fmt.Fprintf(&b, "%d changes, %d conflicts, %d unchanged\n", p.Changes(), p.Conflicts(), p.Unchanged)
+	return b.String()
+}
+
+// PlanLink computes the actions needed to link every entry that isn't
+// linked yet: missing parent directories, symlinks, and skips for targets
+// that are in the way. Directory symlinks into the repository that are in
+// the way are unfolded; with Fold set, whole directories are linked when
+// their target doesn't exist.
+func (p *Planner) PlanLink(entries []Entry) Plan {
+	t := newTree(p)
+	t.plan.Op = "link"
+	for _, e := range entries {
+		t.link(e)
+	}
+	return t.finish()
+}
+
+// PlanUnlink computes the actions needed to remove every linked entry.
+// Entries that aren't linked to this package are left alone.
+func (p *Planner) PlanUnlink(entries []Entry) Plan {
+	t := newTree(p)
+	t.plan.Op = "unlink"
+	t.unlink(entries)
+	return t.finish()
+}
+
+// PlanRestow computes an unlink of every linked entry followed by a link
+// of every entry, like `stow -R`.
+func (p *Planner) PlanRestow(entries []Entry) Plan {
+	t := newTree(p)
+	t.plan.Op = "restow"
+	t.unlink(entries)
+	t.plan.Unchanged = 0
+	for _, e := range entries {
+		t.link(e)
+	}
+	return t.finish()
+}
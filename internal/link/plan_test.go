@@ -0,0 +1,140 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func kinds(plan Plan) []ActionKind {
+	var ks []ActionKind
+	for _, a := range plan.Actions {
+		ks = append(ks, a.Kind)
+	}
+	return ks
+}
+
+func equalKinds(a, b []ActionKind) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPlanLink(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, ".config", "nvim", "init.lua"), "")
+	writeFile(t, filepath.Join(pkg, ".config", "nvim", "lua", "plugins.lua"), "")
+	writeFile(t, filepath.Join(pkg, ".vimrc"), "")
+	writeFile(t, filepath.Join(pkg, ".gvimrc"), "")
+	writeFile(t, filepath.Join(home, ".vimrc"), "local")
+	symlink(t, filepath.Join(pkg, ".gvimrc"), filepath.Join(home, ".gvimrc"))
+
+	p := NewPlanner(root, home)
+	entries, err := p.Scan(pkg)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	plan := p.PlanLink(entries)
+
+	want := []ActionKind{
+		ActionMkdir, ActionMkdir, ActionSymlink, // .config, .config/nvim, init.lua
+		ActionMkdir, ActionSymlink, // .config/nvim/lua, plugins.lua
+		ActionSkip, // .vimrc
+	}
+	if got := kinds(plan); !equalKinds(got, want) {
+		t.Fatalf("PlanLink() kinds = %v, want %v\n%s", got, want, plan)
+	}
+	if plan.Actions[0].Path != filepath.Join(home, ".config") {
+		t.Errorf("PlanLink() first mkdir = %q, want outermost directory", plan.Actions[0].Path)
+	}
+	if plan.Unchanged != 1 || plan.Changes() != 5 || plan.Conflicts() != 1 {
+		t.Errorf("PlanLink() unchanged/changes/conflicts = %d/%d/%d, want 1/5/1",
+			plan.Unchanged, plan.Changes(), plan.Conflicts())
+	}
+
+	// Planning must not touch the filesystem.
+	if _, err := os.Lstat(filepath.Join(home, ".config")); !os.IsNotExist(err) {
+		t.Errorf("PlanLink() created %s", filepath.Join(home, ".config"))
+	}
+}
+
+func TestPlanLinkParentIsFile(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "fish")
+	writeFile(t, filepath.Join(pkg, ".config", "fish", "config.fish"), "")
+	writeFile(t, filepath.Join(home, ".config"), "not a dir")
+
+	p := NewPlanner(root, home)
+	entries, _ := p.Scan(pkg)
+	plan := p.PlanLink(entries)
+
+	if got := kinds(plan); !equalKinds(got, []ActionKind{ActionSkip}) {
+		t.Errorf("PlanLink() kinds = %v, want [skip]", got)
+	}
+}
+
+func TestPlanUnlinkAndRestow(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "git")
+	writeFile(t, filepath.Join(pkg, ".gitconfig"), "")
+	writeFile(t, filepath.Join(pkg, ".gitignore_global"), "")
+	writeFile(t, filepath.Join(pkg, ".gitmessage"), "")
+	symlink(t, filepath.Join(pkg, ".gitconfig"), filepath.Join(home, ".gitconfig"))
+	writeFile(t, filepath.Join(home, ".gitmessage"), "local")
+
+	p := NewPlanner(root, home)
+	entries, _ := p.Scan(pkg)
+
+	unlink := p.PlanUnlink(entries)
+	if got := kinds(unlink); !equalKinds(got, []ActionKind{ActionRemove}) {
+		t.Errorf("PlanUnlink() kinds = %v, want [remove]", got)
+	}
+	if unlink.Unchanged != 2 {
+		t.Errorf("PlanUnlink() unchanged = %d, want 2", unlink.Unchanged)
+	}
+
+	restow := p.PlanRestow(entries)
+	want := []ActionKind{ActionRemove, ActionSymlink, ActionSymlink, ActionSkip}
+	if got := kinds(restow); !equalKinds(got, want) {
+		t.Errorf("PlanRestow() kinds = %v, want %v\n%s", got, want, restow)
+	}
+}
+
+func TestEngineApply(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "nvim")
+	src := filepath.Join(pkg, ".config", "nvim", "init.lua")
+	writeFile(t, src, "")
+
+	e := NewEngine(NewPlanner(root, home))
+	entries, _ := e.Scan(pkg)
+
+	res := e.Apply(e.PlanLink(entries))
+	if res.Done != 1 || len(res.Errors) != 0 {
+		t.Fatalf("Apply(link) = %+v, want 1 done", res)
+	}
+	if !isSymlinkTo(filepath.Join(home, ".config", "nvim", "init.lua"), src) {
+		t.Errorf("Apply(link) did not create symlink")
+	}
+
+	entries, _ = e.Scan(pkg)
+	res = e.Apply(e.PlanRestow(entries))
+	if res.Done != 1 || len(res.Errors) != 0 {
+		t.Errorf("Apply(restow) = %+v, want 1 done", res)
+	}
+	if !isSymlinkTo(filepath.Join(home, ".config", "nvim", "init.lua"), src) {
+		t.Errorf("Apply(restow) did not relink")
+	}
+}
@@ -0,0 +1,176 @@
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Package is a Stow-style package: a top-level directory in the dotfiles repo.
+type Package struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Entry is a single file inside a package together with its target path.
+type Entry struct {
+	Package  string   `json:"package"`            // package name
+	Rel      string   `json:"path"`               // path relative to the package directory
+	Source   string   `json:"source"`             // absolute path of the file inside the repo
+	Target   string   `json:"target"`             // resolved target path under the target directory
+	Status   Status   `json:"status"`             // link status at Target
+	Reason   string   `json:"reason,omitempty"`   // why Status is StatusConflict
+	Conflict Conflict `json:"conflict,omitempty"` // what kind of conflict, for StatusConflict
+	Via      string   `json:"via,omitempty"`      // folded ancestor directory symlink Target is linked through
+	Template bool     `json:"template,omitempty"` // Source is rendered into Target instead of linked
+	Secret   bool     `json:"secret,omitempty"`   // Source is decrypted into Target instead of linked
+	Copy     bool     `json:"copy,omitempty"`     // Source is copied to Target instead of linked
+}
+
+// Packages lists the packages in the dotfiles repository at root.
+func Packages(root string) ([]Package, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directories matched by the repository's .lazydotsignore aren't packages.
+	patterns, err := readGitIgnore(filepath.Join(root, IgnoreFile), "")
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ig := &Ignore{git: patterns}
+
+	var pkgs []Package
+	for _, e := range entries {
+		if !e.IsDir() || ig.Match(e.Name(), true) {
+			// Not a package: a file, .git, or a directory matched by the
+			// repository's .lazydotsignore
+			continue
+		}
+		pkgs = append(pkgs, Package{
+			Name: e.Name(),
+			Path: filepath.Join(root, e.Name()),
+		})
+	}
+	return pkgs, nil
+}
+
+// DefaultTargetDir returns the user's home directory, or "." if it
+// cannot be determined.
+func DefaultTargetDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		// Fallback to current directory if home cannot be determined
+		return "."
+	}
+	return home
+}
+
+// Planner maps package files to their target paths and reports their status.
+type Planner struct {
+	Root         string            // dotfiles repository; symlinks into it are ours to unfold
+	TargetDir    string            // directory package contents are linked into
+	Targets      map[string]string // per-package target directories overriding TargetDir
+	Mapper       TargetMapper      // maps package files to target paths; nil means StowMapper
+	GlobalIgnore string            // stow global ignore file, used by packages without a local one
+	BackupDir    string            // where conflict resolution keeps overwritten files
+	Fold         bool              // link whole directories when their target doesn't exist
+	Relative     bool              // create symlinks relative to their directory, like stow
+	Templates    bool              // render files ending in TemplateSuffix instead of linking them
+	TemplateData TemplateData      // what templates are rendered with
+	Identity     string            // age identity file secrets are decrypted with
+	Copies       map[string]bool   // packages whose files are copied instead of linked
+	Synced       string            // file recording the targets linked or written, to tell drift apart
+	Journal      string            // append-only log of operations, for undo and redo
+}
+
+// NewPlanner returns a Planner for the repository at root that resolves
+// targets under targetDir and keeps its global ignore file and backups there.
+func NewPlanner(root, targetDir string) *Planner {
+	return &Planner{
+		Root:         root,
+		TargetDir:    targetDir,
+		GlobalIgnore: filepath.Join(targetDir, GlobalIgnoreFile),
+		BackupDir:    filepath.Join(targetDir, ".local", "state", "lazydots", "backups"),
+	}
+}
+
+// TargetDirFor returns the directory the package name is linked into.
+func (p *Planner) TargetDirFor(name string) string {
+	if dir, ok := p.Targets[name]; ok {
+		return dir
+	}
+	return p.TargetDir
+}
+
+// TargetFor resolves the target path for a file at rel inside the package
+// name, using the planner's TargetMapper.
+func (p *Planner) TargetFor(name, rel string) string {
+	if p.isTemplate(rel) {
+		rel = strings.TrimSuffix(rel, TemplateSuffix)
+	} else if strings.HasSuffix(rel, SecretSuffix) && len(filepath.Base(rel)) > len(SecretSuffix) {
+		rel = strings.TrimSuffix(rel, SecretSuffix)
+	}
+	return filepath.Join(p.TargetDirFor(name), p.mapper().Map(rel))
+}
+
+func (p *Planner) mapper() TargetMapper {
+	if p.Mapper == nil {
+		return StowMapper{}
+	}
+	return p.Mapper
+}
+
+// Scan walks the package at pkgPath and returns one Entry per file,
+// with its target resolved and its status computed.
+func (p *Planner) Scan(pkgPath string) ([]Entry, error) {
+	name := filepath.Base(pkgPath)
+	ig, err := p.Ignore(pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	err = filepath.WalkDir(pkgPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(pkgPath, path)
+		if err != nil {
+			rel = path
+		}
+
+		if ig.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Only list files, not directories.
+		if d.IsDir() {
+			return nil
+		}
+
+		entries = append(entries, p.Refresh(Entry{
+			Package: name,
+			Rel:     rel,
+			Source:  path,
+			Target:  p.TargetFor(name, rel),
+		}))
+		return nil
+	})
+	return entries, err
+}
+
+// Refresh recomputes the status and conflict reason of e.
+func (p *Planner) Refresh(e Entry) Entry {
+	e = p.classify(e)
+	st := p.state(e)
+	e.Status, e.Conflict, e.Reason, e.Via = st.status, st.conflict, st.reason, st.via
+	return e
+}
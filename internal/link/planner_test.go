@@ -0,0 +1,122 @@
+package link
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPackages(t *testing.T) {
+	root, _ := testRepo(t)
+
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "git", ".gitconfig"), "")
+	writeFile(t, filepath.Join(root, ".git", "HEAD"), "")
+	writeFile(t, filepath.Join(root, "README.md"), "")
+
+	pkgs, err := Packages(root)
+	if err != nil {
+		t.Fatalf("Packages() unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, p := range pkgs {
+		names = append(names, p.Name)
+		if p.Path != filepath.Join(root, p.Name) {
+			t.Errorf("Packages() path = %q, want %q", p.Path, filepath.Join(root, p.Name))
+		}
+	}
+	if len(names) != 2 || names[0] != "bash" || names[1] != "git" {
+		t.Errorf("Packages() = %v, want [bash git]", names)
+	}
+}
+
+func TestPackagesMissingRoot(t *testing.T) {
+	if _, err := Packages("/this/path/does/not/exist/at/all"); err == nil {
+		t.Errorf("Packages() expected error for missing root, got nil")
+	}
+}
+
+func TestPlannerScan(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "fish")
+	writeFile(t, filepath.Join(pkg, ".config", "fish", "config.fish"), "set -x")
+	writeFile(t, filepath.Join(pkg, ".git", "HEAD"), "")
+	writeFile(t, filepath.Join(pkg, ".bashrc"), "")
+	symlink(t, filepath.Join(pkg, ".bashrc"), filepath.Join(home, ".bashrc"))
+
+	p := NewPlanner(root, home)
+	entries, err := p.Scan(pkg)
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+
+	want := map[string]Entry{
+		".bashrc": {
+			Package: "fish",
+			Rel:     ".bashrc",
+			Source:  filepath.Join(pkg, ".bashrc"),
+			Target:  filepath.Join(home, ".bashrc"),
+			Status:  StatusLinked,
+		},
+		filepath.Join(".config", "fish", "config.fish"): {
+			Package: "fish",
+			Rel:     filepath.Join(".config", "fish", "config.fish"),
+			Source:  filepath.Join(pkg, ".config", "fish", "config.fish"),
+			Target:  filepath.Join(home, ".config", "fish", "config.fish"),
+			Status:  StatusMissing,
+		},
+	}
+
+	if len(entries) != len(want) {
+		t.Fatalf("Scan() returned %d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for _, e := range entries {
+		w, ok := want[e.Rel]
+		if !ok {
+			t.Errorf("Scan() unexpected entry %q", e.Rel)
+			continue
+		}
+		if e != w {
+			t.Errorf("Scan() entry = %+v, want %+v", e, w)
+		}
+	}
+}
+
+func TestPlannerTargets(t *testing.T) {
+	root, home := testRepo(t)
+	etc := filepath.Join(filepath.Dir(root), "etc")
+
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "sysctl", "sysctl.conf"), "")
+
+	p := NewPlanner(root, home)
+	p.Targets = map[string]string{"sysctl": etc}
+
+	tests := []struct {
+		pkg  string
+		rel  string
+		want string
+	}{
+		{pkg: "bash", rel: ".bashrc", want: filepath.Join(home, ".bashrc")},
+		{pkg: "sysctl", rel: "sysctl.conf", want: filepath.Join(etc, "sysctl.conf")},
+	}
+	for _, tt := range tests {
+		entries, err := p.Scan(filepath.Join(root, tt.pkg))
+		if err != nil {
+			t.Fatalf("Scan(%s) unexpected error: %v", tt.pkg, err)
+		}
+		if len(entries) != 1 || entries[0].Target != tt.want {
+			t.Errorf("Scan(%s) = %+v, want target %q", tt.pkg, entries, tt.want)
+		}
+	}
+
+	// Linking creates the overridden target directory.
+	e := NewEngine(p)
+	if res := e.Apply(e.PlanLink(scan(t, e, filepath.Join(root, "sysctl")))); res.Done != 1 || len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) = %+v, want 1 done", res)
+	}
+	if !isSymlinkTo(filepath.Join(etc, "sysctl.conf"), filepath.Join(root, "sysctl", "sysctl.conf")) {
+		t.Errorf("Apply(PlanLink()) did not link into the package target")
+	}
+}
@@ -0,0 +1,49 @@
+package link
+
+// PlanSwitch computes an unlink of every linked entry in unlink followed by
+// a link of every entry in link, as a single plan.
+func (p *Planner) PlanSwitch(unlink, link []Entry) Plan {
+	t := newTree(p)
+	t.plan.Op = "switch"
+	t.unlink(unlink)
+	// Entries that stay unlinked aren't worth counting.
+	t.plan.Unchanged = 0
+	for _, e := range link {
+		t.link(e)
+	}
+	return t.finish()
+}
+
+// PlanProfile plans making the packages called names, and the packages
+// they require, the only linked packages: they are linked and every other
+// package is unlinked. It returns the plan and the packages to be linked.
+func (p *Planner) PlanProfile(names []string) (Plan, []Package, error) {
+	// Linked packages outside the profile are unlinked by the plan, so
+	// conflicts with them don't count.
+	keep, err := p.packagesToLink(names, false)
+	if err != nil {
+		return Plan{}, nil, err
+	}
+	kept := map[string]bool{}
+	for _, pkg := range keep {
+		kept[pkg.Name] = true
+	}
+	all, err := Packages(p.Root)
+	if err != nil {
+		return Plan{}, nil, err
+	}
+
+	var unlink, link []Entry
+	for _, pkg := range all {
+		entries, err := p.Scan(pkg.Path)
+		if err != nil {
+			return Plan{}, nil, err
+		}
+		if kept[pkg.Name] {
+			link = append(link, entries...)
+		} else {
+			unlink = append(unlink, entries...)
+		}
+	}
+	return p.PlanSwitch(unlink, link), keep, nil
+}
@@ -0,0 +1,56 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanProfile(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig"), "")
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "bash", ManifestFile), `{"requires": ["git"]}`)
+	writeFile(t, filepath.Join(root, "bash-work", ".bashrc"), "")
+	writeFile(t, filepath.Join(root, "bash-work", ManifestFile), `{"conflicts": ["bash"]}`)
+	writeFile(t, filepath.Join(root, "tmux", ".tmux.conf"), "")
+
+	// The work machine currently has bash-work and tmux linked.
+	symlink(t, filepath.Join(root, "bash-work", ".bashrc"), filepath.Join(home, ".bashrc"))
+	symlink(t, filepath.Join(root, "tmux", ".tmux.conf"), filepath.Join(home, ".tmux.conf"))
+
+	e := NewEngine(NewPlanner(root, home))
+	plan, pkgs, err := e.PlanProfile([]string{"bash"})
+	if err != nil {
+		t.Fatalf("PlanProfile() unexpected error: %v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Name != "git" || pkgs[1].Name != "bash" {
+		t.Errorf("PlanProfile() packages = %+v, want git and bash", pkgs)
+	}
+	if plan.Conflicts() != 0 {
+		t.Fatalf("PlanProfile() has conflicts:\n%s", plan)
+	}
+
+	if res := e.Apply(plan); len(res.Errors) > 0 {
+		t.Fatalf("Apply() errors: %v", res.Errors)
+	}
+	if !isSymlinkTo(filepath.Join(home, ".bashrc"), filepath.Join(root, "bash", ".bashrc")) {
+		t.Errorf(".bashrc was not switched to the bash package")
+	}
+	if !isSymlinkTo(filepath.Join(home, ".gitconfig"), filepath.Join(root, "git", ".gitconfig")) {
+		t.Errorf("the required git package was not linked")
+	}
+	if _, err := os.Lstat(filepath.Join(home, ".tmux.conf")); !os.IsNotExist(err) {
+		t.Errorf("tmux, outside the profile, is still linked")
+	}
+
+	// Applying again changes nothing.
+	plan, _, err = e.PlanProfile([]string{"bash"})
+	if err != nil || plan.Changes() != 0 {
+		t.Errorf("second PlanProfile() = %v, %v; want no changes", plan, err)
+	}
+
+	if _, _, err := e.PlanProfile([]string{"bash", "bash-work"}); err == nil {
+		t.Error("PlanProfile() of conflicting packages expected error, got nil")
+	}
+}
@@ -0,0 +1,127 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRelativeLinks(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "fish")
+	src := filepath.Join(pkg, ".config", "fish", "config.fish")
+	writeFile(t, src, "")
+
+	p := NewPlanner(root, home)
+	p.Relative = true
+	e := NewEngine(p)
+
+	if res := e.Apply(e.PlanLink(scan(t, e, pkg))); res.Done != 1 || len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) = %+v, want 1 done", res)
+	}
+
+	target := filepath.Join(home, ".config", "fish", "config.fish")
+	raw, err := os.Readlink(target)
+	if err != nil {
+		t.Fatalf("Readlink() unexpected error: %v", err)
+	}
+	want := filepath.Join("..", "..", "..", "dotfiles", "fish", ".config", "fish", "config.fish")
+	if raw != want {
+		t.Errorf("link text = %q, want %q", raw, want)
+	}
+	if got := e.Refresh(scan(t, e, pkg)[0]).Status; got != StatusLinked {
+		t.Errorf("status = %v, want linked", got)
+	}
+
+	// Moving the repo and home together keeps the link intact.
+	base := filepath.Dir(root)
+	moved := base + "-moved"
+	if err := os.Rename(base, moved); err != nil {
+		t.Fatalf("failed to move test tree: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(moved) })
+
+	after := NewEngine(NewPlanner(filepath.Join(moved, "dotfiles"), filepath.Join(moved, "home")))
+	entry := scan(t, after, filepath.Join(after.Root, "fish"))[0]
+	if entry.Status != StatusLinked {
+		t.Errorf("status after move = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+	if err := after.Unlink(entry); err != nil {
+		t.Errorf("Unlink() after move unexpected error: %v", err)
+	}
+}
+
+func TestRelativeLinkThroughSymlinkedDir(t *testing.T) {
+	root, home := testRepo(t)
+
+	pkg := filepath.Join(root, "fish")
+	src := filepath.Join(pkg, ".config", "fish", "config.fish")
+	writeFile(t, src, "")
+
+	// ~/.config lives somewhere else entirely.
+	elsewhere := filepath.Join(filepath.Dir(root), "elsewhere", "config")
+	if err := os.MkdirAll(elsewhere, 0o755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+	symlink(t, elsewhere, filepath.Join(home, ".config"))
+
+	e := NewEngine(NewPlanner(root, home))
+	entries := scan(t, e, pkg)
+	if res := e.LinkWith(entries[0], true); len(res.Errors) > 0 {
+		t.Fatalf("LinkWith() errors: %v", res.Errors)
+	}
+
+	target := filepath.Join(home, ".config", "fish", "config.fish")
+	if data, err := os.ReadFile(target); err != nil {
+		t.Errorf("relative link does not resolve: %v (%q)", err, data)
+	}
+	if got := e.Refresh(entries[0]).Status; got != StatusLinked {
+		t.Errorf("status = %v, want linked", got)
+	}
+}
+
+func TestLinkWithReplacesLink(t *testing.T) {
+	root, home := testRepo(t)
+	pkg := filepath.Join(root, "fish")
+	writeFile(t, filepath.Join(pkg, ".config", "fish", "config.fish"), "")
+	target := filepath.Join(home, ".config", "fish", "config.fish")
+
+	e := NewEngine(NewPlanner(root, home))
+	entry := scan(t, e, pkg)[0]
+	if err := e.Link(entry); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+
+	if res := e.LinkWith(e.Refresh(entry), true); res.Done != 1 || len(res.Errors) > 0 {
+		t.Fatalf("LinkWith() of an absolute link = %+v, want 1 done", res)
+	}
+	if raw, err := os.Readlink(target); err != nil || filepath.IsAbs(raw) {
+		t.Errorf("link text = %q (err %v), want a relative link", raw, err)
+	}
+	if got := e.Refresh(entry).Status; got != StatusLinked {
+		t.Errorf("status = %v, want linked", got)
+	}
+
+	if res := e.LinkWith(e.Refresh(entry), true); res.Done != 0 || res.Skipped != 1 {
+		t.Errorf("LinkWith() of a relative link = %+v, want it unchanged", res)
+	}
+}
+
+func TestPlanWithRelative(t *testing.T) {
+	plan := Plan{Actions: []Action{
+		{Kind: ActionMkdir, Path: "/home/u/.config"},
+		{Kind: ActionSymlink, Path: "/home/u/.config/x", Source: "/repo/pkg/.config/x"},
+	}}
+
+	rel := plan.WithRelative(true)
+	if !rel.Actions[1].Relative || rel.Actions[0].Relative {
+		t.Errorf("WithRelative(true) = %+v, want only the symlink relative", rel.Actions)
+	}
+	if plan.Actions[1].Relative {
+		t.Errorf("WithRelative() modified the original plan")
+	}
+	if got := linkText(rel.Actions[1]); got != "../../../repo/pkg/.config/x" {
+		t.Errorf("linkText() = %q", got)
+	}
+}
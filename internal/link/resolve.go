@@ -0,0 +1,312 @@
+package link
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Resolution is a way of resolving a conflict so an entry can be linked.
+type Resolution int
+
+const (
+	ResolveBackup    Resolution = iota // rename the existing target to a timestamped backup next to it
+	ResolveOverwrite                   // move the existing target into the backup store
+	ResolveAdopt                       // move the existing target into the package, like stow --adopt
+)
+
+func (r Resolution) String() string {
+	switch r {
+	case ResolveBackup:
+		return "backup"
+	case ResolveOverwrite:
+		return "overwrite"
+	case ResolveAdopt:
+		return "adopt"
+	}
+	return "unknown"
+}
+
+func (r Resolution) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Resolution) UnmarshalText(text []byte) error {
+	for _, c := range []Resolution{ResolveBackup, ResolveOverwrite, ResolveAdopt} {
+		if c.String() == string(text) {
+			*r = c
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown resolution %q", text)
+}
+
+// backupStamp is the time format used in backup names.
+const backupStamp = "20060102-150405"
+
+// Backup records what a conflict resolution moved, so Restore can undo it.
+type Backup struct {
+	Resolution Resolution `json:"resolution"`
+	Target     string     `json:"target"` // conflicting path, now linked into the package
+	Source     string     `json:"source"` // package file Target is linked to
+	Path       string     `json:"path"`   // previous Target, or for adopt the previous Source
+}
+
+// Resolve clears the conflict at entry's target as described by how, then
+// links the entry. Nothing is ever deleted: the previous contents are kept
+// at the returned Backup's Path.
+func (e *Engine) Resolve(entry Entry, how Resolution) (Backup, error) {
+	b, err := e.resolve(entry, how)
+	if err == nil {
+		e.appendJournal(JournalEntry{Op: "resolve", Backup: &b, Entry: &entry})
+	}
+	return b, err
+}
+
+// resolve implements Resolve without journaling it.
+func (e *Engine) resolve(entry Entry, how Resolution) (Backup, error) {
+	entry = e.Refresh(entry)
+	if entry.Status != StatusConflict {
+		return Backup{}, fmt.Errorf("%s is not in conflict", entry.Target)
+	}
+	if !slices.Contains(entry.Conflict.Resolutions(), how) {
+		return Backup{}, fmt.Errorf("cannot %s %s: %s", how, entry.Target, entry.Reason)
+	}
+	info, err := os.Lstat(entry.Target)
+	if err != nil {
+		return Backup{}, fmt.Errorf("cannot resolve %s: %s", entry.Target, entry.Reason)
+	}
+
+	stamp := time.Now().Format(backupStamp)
+	b := Backup{Resolution: how, Target: entry.Target, Source: entry.Source}
+	switch how {
+	case ResolveBackup:
+		b.Path = uniquePath(entry.Target + ".bak-" + stamp)
+		err = move(entry.Target, b.Path)
+
+	case ResolveOverwrite:
+		b.Path = uniquePath(e.backupPath(stamp, entry.Target))
+		err = move(entry.Target, b.Path)
+
+	case ResolveAdopt:
+		if !info.Mode().IsRegular() {
+			return Backup{}, fmt.Errorf("can only adopt regular files: %s", entry.Target)
+		}
+		if entry.Template {
+			return Backup{}, fmt.Errorf("cannot adopt into a template, edit %s instead", entry.Source)
+		}
+		b.Path = uniquePath(e.backupPath(stamp, entry.Source))
+		if entry.Secret || entry.Copy {
+			err = e.adoptOutput(entry, b.Path)
+		} else if err = move(entry.Source, b.Path); err == nil {
+			if err = move(entry.Target, entry.Source); err != nil {
+				err = errors.Join(err, move(b.Path, entry.Source))
+			}
+		}
+
+	default:
+		return Backup{}, fmt.Errorf("unknown resolution %v", how)
+	}
+	if err != nil {
+		return Backup{}, fmt.Errorf("%s failed: %w", how, err)
+	}
+
+	if res, _ := e.apply(e.PlanLink([]Entry{entry})); len(res.Errors) > 0 {
+		return Backup{}, errors.Join(append(res.Errors, e.Restore(b))...)
+	}
+	return b, nil
+}
+
+// Restore undoes a conflict resolution: the symlink at b.Target is removed
+// and everything Resolve moved is put back where it was.
+func (e *Engine) Restore(b Backup) error {
+	if b.Resolution == ResolveAdopt && e.classify(Entry{Source: b.Source}).Generated() {
+		// The target was kept as it was, only the package file was replaced.
+		if err := os.Remove(b.Source); err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		if err := move(b.Path, b.Source); err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		// The target no longer matches its source and must not look stale.
+		e.forgetSynced(b.Target)
+		return nil
+	}
+	if info, err := os.Lstat(b.Target); err == nil {
+		if !e.resolvedTo(b, info) {
+			return fmt.Errorf("refusing to restore, %s has changed since", b.Target)
+		}
+		if err := os.Remove(b.Target); err != nil {
+			return fmt.Errorf("remove failed: %w", err)
+		}
+	}
+
+	if b.Resolution == ResolveAdopt {
+		if err := move(b.Source, b.Target); err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		if err := move(b.Path, b.Source); err != nil {
+			return fmt.Errorf("restore failed: %w", err)
+		}
+		return nil
+	}
+	if err := move(b.Path, b.Target); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	return nil
+}
+
+// resolvedTo reports whether the target of b, described by info, is still
+// what Resolve left there: a symlink to b.Source, or for templates and
+// secrets the generated file.
+func (e *Engine) resolvedTo(b Backup, info os.FileInfo) bool {
+	src := e.classify(Entry{Source: b.Source})
+	if info.Mode().IsRegular() && src.Generated() {
+		want, err := e.Output(src)
+		if err != nil {
+			return false
+		}
+		got, err := os.ReadFile(b.Target)
+		return err == nil && bytes.Equal(got, want)
+	}
+	dest, err := readLink(b.Target)
+	return err == nil && samePath(dest, b.Source)
+}
+
+// adoptOutput copies the file at entry's target back into its package
+// file, re-encrypting it for a secret, and keeps the previous package file
+// at backup. The target stays where it is.
+func (e *Engine) adoptOutput(entry Entry, backup string) error {
+	content, err := os.ReadFile(entry.Target)
+	if err != nil {
+		return err
+	}
+	enc := content
+	if entry.Secret {
+		if enc, err = e.Encrypt(entry.Source, content); err != nil {
+			return err
+		}
+	}
+	info, err := os.Stat(entry.Source)
+	if err != nil {
+		return err
+	}
+	if err := move(entry.Source, backup); err != nil {
+		return err
+	}
+	if err := writeNew(entry.Source, enc, info.Mode().Perm()); err != nil {
+		return errors.Join(err, move(backup, entry.Source))
+	}
+	e.markSynced(entry.Target, content)
+	return nil
+}
+
+// backupPath returns where path is kept in the backup store for the
+// resolution at stamp, mirroring its absolute path.
+func (e *Engine) backupPath(stamp, path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	rel := strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	return filepath.Join(e.BackupDir, stamp, rel)
+}
+
+// uniquePath returns path, or path with a numeric suffix if it is taken.
+func uniquePath(path string) string {
+	candidate := path
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = path + "." + strconv.Itoa(i)
+	}
+}
+
+// move renames src to dst, creating dst's parents. Files and directories
+// are copied (keeping their modes) when src and dst are on different
+// filesystems.
+func move(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// copyTree copies src to dst: regular files, symlinks and directories,
+// keeping their permissions.
+func copyTree(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		raw, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(raw, dst)
+
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()|0o700); err != nil {
+			return err
+		}
+		children, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			if err := copyTree(filepath.Join(src, c.Name()), filepath.Join(dst, c.Name())); err != nil {
+				return err
+			}
+		}
+		// Restore the exact mode once the directory is filled.
+		return os.Chmod(dst, info.Mode().Perm())
+
+	case info.Mode().IsRegular():
+		return copyFile(src, dst, info.Mode().Perm())
+	}
+	return fmt.Errorf("cannot copy %s: unsupported file type", src)
+}
+
+// copyFile copies the regular file src to a new file dst with mode perm.
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	// The umask may have narrowed perm.
+	return os.Chmod(dst, perm)
+}
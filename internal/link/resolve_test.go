@@ -0,0 +1,119 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		how        Resolution
+		wantSource string // package file content after resolving
+		wantBackup string // content kept at Backup.Path
+		backupDir  bool   // backup lives in the backup store, not next to the target
+	}{
+		{how: ResolveBackup, wantSource: "repo", wantBackup: "local"},
+		{how: ResolveOverwrite, wantSource: "repo", wantBackup: "local", backupDir: true},
+		{how: ResolveAdopt, wantSource: "local", wantBackup: "repo", backupDir: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.how.String(), func(t *testing.T) {
+			root, home := testRepo(t)
+			src := filepath.Join(root, "bash", ".bashrc")
+			target := filepath.Join(home, ".bashrc")
+			writeFile(t, src, "repo")
+			writeFile(t, target, "local")
+			if err := os.Chmod(target, 0o600); err != nil {
+				t.Fatalf("chmod failed: %v", err)
+			}
+
+			p := NewPlanner(root, home)
+			p.BackupDir = filepath.Join(filepath.Dir(root), "backups")
+			e := NewEngine(p)
+			entries := scan(t, e, filepath.Join(root, "bash"))
+
+			b, err := e.Resolve(entries[0], tt.how)
+			if err != nil {
+				t.Fatalf("Resolve() unexpected error: %v", err)
+			}
+			if got := e.Refresh(entries[0]).Status; got != StatusLinked {
+				t.Errorf("status after Resolve() = %v, want linked", got)
+			}
+			if got := readFile(t, src); got != tt.wantSource {
+				t.Errorf("package file = %q, want %q", got, tt.wantSource)
+			}
+			if got := readFile(t, b.Path); got != tt.wantBackup {
+				t.Errorf("backup %s = %q, want %q", b.Path, got, tt.wantBackup)
+			}
+			if inStore := strings.HasPrefix(b.Path, p.BackupDir); inStore != tt.backupDir {
+				t.Errorf("backup path %s in backup store = %v, want %v", b.Path, inStore, tt.backupDir)
+			}
+
+			if err := e.Restore(b); err != nil {
+				t.Fatalf("Restore() unexpected error: %v", err)
+			}
+			if got := readFile(t, target); got != "local" {
+				t.Errorf("target after Restore() = %q, want %q", got, "local")
+			}
+			if got := readFile(t, src); got != "repo" {
+				t.Errorf("package file after Restore() = %q, want %q", got, "repo")
+			}
+			if info, err := os.Lstat(target); err != nil || info.Mode().Perm() != 0o600 {
+				t.Errorf("target after Restore() = %v (err %v), want a 0600 file", info, err)
+			}
+			if _, err := os.Lstat(b.Path); !os.IsNotExist(err) {
+				t.Errorf("backup %s still exists after Restore()", b.Path)
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "bash", ".bashrc"), "repo")
+	writeFile(t, filepath.Join(root, "bash", ".profile"), "repo")
+	writeFile(t, filepath.Join(home, ".profile", "nested"), "")
+
+	e := NewEngine(NewPlanner(root, home))
+	entries := scan(t, e, filepath.Join(root, "bash"))
+
+	if _, err := e.Resolve(entries[0], ResolveBackup); err == nil {
+		t.Errorf("Resolve() on a missing target expected error, got nil")
+	}
+	if _, err := e.Resolve(entries[1], ResolveAdopt); err == nil {
+		t.Errorf("Resolve(adopt) on a directory expected error, got nil")
+	}
+	if _, err := os.Stat(filepath.Join(home, ".profile", "nested")); err != nil {
+		t.Errorf("failed Resolve() changed the target: %v", err)
+	}
+
+	// A directory in the way can still be backed up.
+	b, err := e.Resolve(entries[1], ResolveBackup)
+	if err != nil {
+		t.Fatalf("Resolve(backup) on a directory unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.Path, "nested")); err != nil {
+		t.Errorf("backed up directory lost its contents: %v", err)
+	}
+
+	// Restore refuses to clobber a target that changed since.
+	if err := os.Remove(b.Target); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+	writeFile(t, b.Target, "new")
+	if err := e.Restore(b); err == nil {
+		t.Errorf("Restore() over a changed target expected error, got nil")
+	}
+}
@@ -0,0 +1,179 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// SecretSuffix marks package files encrypted with age. They are decrypted
+// into their target instead of linked, and the suffix is dropped from the
+// target name: "dot-netrc.age" -> "~/.netrc". A package manifest can mark
+// more files as secrets with "secrets".
+const SecretSuffix = ".age"
+
+// isSecret reports whether the package file src is an encrypted secret.
+func (p *Planner) isSecret(src string) bool {
+	if strings.HasSuffix(src, SecretSuffix) && len(filepath.Base(src)) > len(SecretSuffix) {
+		return true
+	}
+	return p.manifestLists(src, func(m Manifest) []string { return m.Secrets })
+}
+
+// identities reads the age identities from the planner's Identity file.
+func (p *Planner) identities() ([]age.Identity, error) {
+	if p.Identity == "" {
+		return nil, errors.New("no identity file configured")
+	}
+	f, err := os.Open(p.Identity)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read identity: %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity file %s: %w", p.Identity, err)
+	}
+	return ids, nil
+}
+
+// Decrypt decrypts the age-encrypted file at src, binary or armored, with
+// the planner's identities.
+func (p *Planner) Decrypt(src string) ([]byte, error) {
+	ids, err := p.identities()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var in io.Reader = br
+	if start, _ := br.Peek(len(armor.Header)); string(start) == armor.Header {
+		in = armor.NewReader(br)
+	}
+	r, err := age.Decrypt(in, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// Encrypt encrypts content for the secret at src, so that Decrypt can read
+// it back: to the recipients of the planner's identities and those listed
+// in the package manifest's "recipients", armored if src is. It refuses if
+// src is encrypted to more recipients than that, since re-encrypting it
+// would lock the others out.
+func (p *Planner) Encrypt(src string, content []byte) ([]byte, error) {
+	ids, err := p.identities()
+	if err != nil {
+		return nil, err
+	}
+	var recipients []age.Recipient
+	seen := make(map[string]bool)
+	add := func(r *age.X25519Recipient) {
+		if !seen[r.String()] {
+			seen[r.String()] = true
+			recipients = append(recipients, r)
+		}
+	}
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			add(x.Recipient())
+		}
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no X25519 identity in %s to encrypt to", p.Identity)
+	}
+	if pkg := packageOf(p.Root, src); pkg != "" {
+		m, err := ReadManifest(filepath.Join(p.Root, pkg))
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range m.Recipients {
+			r, err := age.ParseX25519Recipient(key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid recipient in package %s: %w", pkg, err)
+			}
+			add(r)
+		}
+	}
+
+	armored, stanzas, err := secretHeader(src)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if stanzas > len(recipients) {
+		return nil, fmt.Errorf("%s is encrypted to %d recipients, but only %d are known; list the others under \"recipients\" in the package manifest", src, stanzas, len(recipients))
+	}
+
+	var out bytes.Buffer
+	var dst io.WriteCloser = nopCloser{&out}
+	if armored {
+		dst = armor.NewWriter(&out)
+	}
+	w, err := age.Encrypt(dst, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := dst.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// secretHeader reports whether the age file at src is armored and how many
+// recipient stanzas its header has. Grease stanzas, which some age
+// implementations add, don't count.
+func secretHeader(src string) (armored bool, stanzas int, err error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return false, 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var in io.Reader = br
+	if start, _ := br.Peek(len(armor.Header)); string(start) == armor.Header {
+		armored, in = true, armor.NewReader(br)
+	}
+	sc := bufio.NewScanner(in)
+	if !sc.Scan() || sc.Text() != "age-encryption.org/v1" {
+		return false, 0, fmt.Errorf("%s is not an age file", src)
+	}
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "---") {
+			return armored, stanzas, nil
+		}
+		if kind, ok := strings.CutPrefix(line, "-> "); ok {
+			kind, _, _ = strings.Cut(kind, " ")
+			if !strings.HasSuffix(kind, "-grease") {
+				stanzas++
+			}
+		}
+	}
+	return false, 0, fmt.Errorf("%s has a truncated age header", src)
+}
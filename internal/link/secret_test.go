@@ -0,0 +1,207 @@
+package link
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// secretPlanner returns a planner with a freshly generated identity, and
+// writes content encrypted to it at src.
+func secretPlanner(t *testing.T, root, home, src, content string) *Planner {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() unexpected error: %v", err)
+	}
+	p := NewPlanner(root, home)
+	p.Identity = filepath.Join(t.TempDir(), "key.txt")
+	writeFile(t, p.Identity, id.String()+"\n")
+
+	enc, err := p.Encrypt(src, []byte(content))
+	if err != nil {
+		t.Fatalf("Encrypt() unexpected error: %v", err)
+	}
+	writeFile(t, src, string(enc))
+	return p
+}
+
+func TestSecretLinkAndUnlink(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "net", "dot-netrc.age")
+	e := NewEngine(secretPlanner(t, root, home, src, "machine example.com password hunter2\n"))
+	e.Mapper = DotfilesMapper{}
+	target := filepath.Join(home, ".netrc")
+
+	entries, err := e.Scan(filepath.Join(root, "net"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Target != target || !entries[0].Secret {
+		t.Fatalf("Scan() = %+v, want a secret entry for .netrc", entries)
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+	if string(got) != "machine example.com password hunter2\n" {
+		t.Errorf("decrypted %q", got)
+	}
+	if info, _ := os.Stat(target); info.Mode().Perm() != 0o600 {
+		t.Errorf("decrypted mode = %v, want 0600", info.Mode().Perm())
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after decrypt = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+
+	if err := e.Unlink(entries[0]); err != nil {
+		t.Fatalf("Unlink() unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("decrypted file still exists after unlink: %v", err)
+	}
+}
+
+func TestSecretFromManifest(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "ssh", ".ssh", "config.d", "work")
+	p := secretPlanner(t, root, home, src, "Host work\n")
+	writeFile(t, filepath.Join(root, "ssh", ManifestFile), `{"secrets": [".ssh/config.d/work"]}`)
+
+	entries, err := p.Scan(filepath.Join(root, "ssh"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if len(entries) != 1 || !entries[0].Secret || entries[0].Target != filepath.Join(home, ".ssh", "config.d", "work") {
+		t.Errorf("Scan() = %+v, want a secret entry keeping its name", entries)
+	}
+}
+
+func TestSecretDriftAdopt(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "net", ".netrc.age")
+	e := NewEngine(secretPlanner(t, root, home, src, "password old\n"))
+	target := filepath.Join(home, ".netrc")
+	writeFile(t, target, "password new\n")
+
+	entries, err := e.Scan(filepath.Join(root, "net"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if entries[0].Conflict != ConflictDrift {
+		t.Fatalf("Scan() conflict = %v, want drift", entries[0].Conflict)
+	}
+
+	b, err := e.Resolve(entries[0], ResolveAdopt)
+	if err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+	if got, err := e.Decrypt(src); err != nil || string(got) != "password new\n" {
+		t.Errorf("Decrypt() after adopt = %q, %v; want the adopted file", got, err)
+	}
+	if raw, _ := os.ReadFile(src); strings.Contains(string(raw), "password") {
+		t.Error("adopted secret is stored in plaintext")
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after adopt = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+
+	if err := e.Restore(b); err != nil {
+		t.Fatalf("Restore() unexpected error: %v", err)
+	}
+	if got, _ := e.Decrypt(src); string(got) != "password old\n" {
+		t.Errorf("Decrypt() after restore = %q, want the previous secret", got)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "password new\n" {
+		t.Errorf("target after restore = %q, want it kept", got)
+	}
+}
+
+func TestSecretAdoptKeepsRecipients(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "net", ".netrc.age")
+	e := NewEngine(secretPlanner(t, root, home, src, "password old\n"))
+	ids, err := e.identities()
+	if err != nil {
+		t.Fatalf("identities() unexpected error: %v", err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() unexpected error: %v", err)
+	}
+
+	// Encrypt the secret, armored, to someone else as well.
+	var buf bytes.Buffer
+	aw := armor.NewWriter(&buf)
+	w, err := age.Encrypt(aw, ids[0].(*age.X25519Identity).Recipient(), other.Recipient())
+	if err != nil {
+		t.Fatalf("Encrypt() unexpected error: %v", err)
+	}
+	io.WriteString(w, "password old\n")
+	w.Close()
+	aw.Close()
+	writeFile(t, src, buf.String())
+	writeFile(t, filepath.Join(home, ".netrc"), "password new\n")
+
+	entries, err := e.Scan(filepath.Join(root, "net"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if _, err := e.Resolve(entries[0], ResolveAdopt); err == nil {
+		t.Fatal("Resolve() adopted a secret with a recipient it can't encrypt to")
+	}
+	if got := readFile(t, src); got != buf.String() {
+		t.Error("refused adopt changed the secret")
+	}
+
+	writeFile(t, filepath.Join(root, "net", ManifestFile), fmt.Sprintf(`{"recipients": [%q]}`, other.Recipient()))
+	if _, err := e.Resolve(entries[0], ResolveAdopt); err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+	raw := readFile(t, src)
+	if !strings.HasPrefix(raw, armor.Header) {
+		t.Error("adopted secret is no longer armored")
+	}
+	r, err := age.Decrypt(armor.NewReader(strings.NewReader(raw)), other)
+	if err != nil {
+		t.Fatalf("other recipient can't decrypt the adopted secret: %v", err)
+	}
+	if got, _ := io.ReadAll(r); string(got) != "password new\n" {
+		t.Errorf("other recipient decrypted %q, want the adopted file", got)
+	}
+}
+
+func TestSecretWrongIdentity(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "net", ".netrc.age")
+	p := secretPlanner(t, root, home, src, "secret\n")
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() unexpected error: %v", err)
+	}
+	writeFile(t, p.Identity, other.String()+"\n")
+
+	entries, err := p.Scan(filepath.Join(root, "net"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	plan := p.PlanLink(entries)
+	if len(plan.Actions) != 1 || plan.Actions[0].Kind != ActionSkip || !strings.Contains(plan.Actions[0].Reason, "cannot decrypt") {
+		t.Errorf("PlanLink() = %+v, want a decryption skip", plan.Actions)
+	}
+
+	writeFile(t, filepath.Join(home, ".netrc"), "")
+	if entry := p.Refresh(entries[0]); entry.Conflict != ConflictSecret {
+		t.Errorf("Refresh() conflict = %v, want secret-error", entry.Conflict)
+	}
+}
@@ -0,0 +1,235 @@
+package link
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Status describes the state of a package file's target path.
+type Status int
+
+const (
+	StatusMissing  Status = iota // no file at target path
+	StatusLinked                 // symlink exists and points to this package file
+	StatusConflict               // file exists but is not the right symlink / some other issue
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusMissing:
+		return "missing"
+	case StatusLinked:
+		return "linked"
+	case StatusConflict:
+		return "conflict"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the status as its name, e.g. "linked".
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status name produced by MarshalText.
+func (s *Status) UnmarshalText(text []byte) error {
+	for _, st := range []Status{StatusMissing, StatusLinked, StatusConflict} {
+		if st.String() == string(text) {
+			*s = st
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown link status %q", text)
+}
+
+// Conflict says what is in the way of a target in StatusConflict.
+type Conflict int
+
+const (
+	ConflictNone       Conflict = iota // not in conflict
+	ConflictFile                       // a regular file (or another non-directory) is in the way
+	ConflictDir                        // a directory is in the way
+	ConflictPackage                    // a symlink into the repository, usually to another package
+	ConflictForeign                    // a symlink pointing outside the repository
+	ConflictUnreadable                 // the target could not be inspected, e.g. permission denied
+	ConflictDrift                      // a generated file was edited, or a link replaced by a file, since it was written
+	ConflictTemplate                   // the template fails to render
+	ConflictSecret                     // the secret can't be decrypted
+	ConflictStale                      // a generated file is unchanged but its source changed
+)
+
+func (c Conflict) String() string {
+	switch c {
+	case ConflictNone:
+		return ""
+	case ConflictFile:
+		return "file"
+	case ConflictDir:
+		return "directory"
+	case ConflictPackage:
+		return "package-link"
+	case ConflictForeign:
+		return "foreign-link"
+	case ConflictUnreadable:
+		return "unreadable"
+	case ConflictDrift:
+		return "drift"
+	case ConflictTemplate:
+		return "template-error"
+	case ConflictSecret:
+		return "secret-error"
+	case ConflictStale:
+		return "stale"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the conflict as its name, e.g. "directory".
+func (c Conflict) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalText decodes a conflict name produced by MarshalText.
+func (c *Conflict) UnmarshalText(text []byte) error {
+	for _, k := range []Conflict{ConflictNone, ConflictFile, ConflictDir, ConflictPackage, ConflictForeign, ConflictUnreadable, ConflictDrift, ConflictTemplate, ConflictSecret, ConflictStale} {
+		if k.String() == string(text) {
+			*c = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown conflict %q", text)
+}
+
+// Resolutions returns the ways a conflict of this kind can be resolved.
+// Only regular files can be adopted; for drift that takes the edited file
+// into the repo (except into a template, which Resolve refuses). An
+// unreadable target, a broken template or an undecryptable secret has to
+// be fixed by hand.
+func (c Conflict) Resolutions() []Resolution {
+	switch c {
+	case ConflictFile, ConflictDrift:
+		return []Resolution{ResolveBackup, ResolveOverwrite, ResolveAdopt}
+	case ConflictDir, ConflictPackage, ConflictForeign, ConflictStale:
+		return []Resolution{ResolveBackup, ResolveOverwrite}
+	}
+	return nil
+}
+
+// state is what inspect found at a target path.
+type state struct {
+	status   Status
+	conflict Conflict
+	reason   string
+	via      string // folded ancestor directory symlink the target is linked through
+}
+
+// inspect checks what's at targetPath and whether it is a symlink pointing
+// back to srcPath (the file inside the package), and explains a conflict.
+// Symlinks into root, the repository, are told apart from foreign ones.
+func inspect(root, srcPath, targetPath string) state {
+	info, err := os.Lstat(targetPath)
+	if os.IsNotExist(err) {
+		return state{status: StatusMissing}
+	}
+	if err != nil {
+		return conflict(ConflictUnreadable, fmt.Sprintf("lstat failed: %v", err))
+	}
+
+	// If it's a symlink, check where it points.
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := readLink(targetPath)
+		if err != nil {
+			return conflict(ConflictUnreadable, fmt.Sprintf("readlink failed: %v", err))
+		}
+		if samePath(srcPath, dest) {
+			return state{status: StatusLinked}
+		}
+		if packageOf(root, dest) != "" {
+			return conflict(ConflictPackage, linkedElsewhere(root, dest))
+		}
+		return conflict(ConflictForeign, linkedElsewhere(root, dest))
+	}
+
+	// Not a symlink itself, but it may be reached through a folded
+	// directory symlink, like `stow` creates.
+	if via := foldedVia(srcPath, targetPath); via != "" {
+		return state{status: StatusLinked, via: via}
+	}
+
+	// Some other file/dir is in the way.
+	if info.IsDir() {
+		return conflict(ConflictDir, "a directory is in the way")
+	}
+	return conflict(ConflictFile, "target already exists and is not a symlink")
+}
+
+// conflict returns a StatusConflict state of the given kind.
+func conflict(kind Conflict, reason string) state {
+	return state{status: StatusConflict, conflict: kind, reason: reason}
+}
+
+// foldedVia returns the ancestor directory of targetPath that is a symlink
+// through which targetPath resolves to srcPath, or "" if there is none.
+func foldedVia(srcPath, targetPath string) string {
+	for dir := filepath.Dir(targetPath); ; dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if dest, err := readLink(dir); err == nil {
+				rest, err := filepath.Rel(dir, targetPath)
+				if err == nil && samePath(filepath.Join(dest, rest), srcPath) {
+					return dir
+				}
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			return ""
+		}
+	}
+}
+
+// readLink returns the absolute destination of the symlink at path.
+// Relative link destinations are resolved against the link's directory.
+func readLink(path string) (string, error) {
+	dest, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(path), dest)
+	}
+	return filepath.Abs(dest)
+}
+
+// samePath reports whether a and b refer to the same absolute path. Paths
+// that differ only because a parent directory is reached through a symlink
+// (as happens with relative links) are considered the same; the final
+// component is compared as is, so a symlink is not the file it points to.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	if absA == absB {
+		return true
+	}
+	realA, errA := resolveDir(absA)
+	realB, errB := resolveDir(absB)
+	return errA == nil && errB == nil && realA == realB
+}
+
+// resolveDir resolves every symlink in the parent directories of path.
+func resolveDir(path string) (string, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// within reports whether path is root or inside it.
+func within(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
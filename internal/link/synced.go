@@ -0,0 +1,111 @@
+package link
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// hash returns the hex SHA-256 of content.
+func hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// synced reads the Synced file: every target LazyDots linked or wrote, with
+// the hash of what was written to generated targets ("" for symlinks). It
+// is empty if there is none.
+func (p *Planner) synced() map[string]string {
+	m := map[string]string{}
+	if p.Synced == "" {
+		return m
+	}
+	if data, err := os.ReadFile(p.Synced); err == nil {
+		json.Unmarshal(data, &m)
+	}
+	return m
+}
+
+// recordSynced updates the Synced file after the actions were applied:
+// symlinks and generated files written are recorded, removed ones
+// forgotten. Records only refine why a target is out of sync, so failing
+// to save them is not an error.
+func (p *Planner) recordSynced(actions []Action) {
+	if p.Synced == "" {
+		return
+	}
+	m := p.synced()
+	changed := false
+	for _, a := range actions {
+		switch a.Kind {
+		case ActionSymlink:
+			m[a.Path] = ""
+		case ActionRender:
+			m[a.Path] = hash(a.Content)
+		case ActionRemove:
+			delete(m, a.Path)
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		p.saveSynced(m)
+	}
+}
+
+// markSynced records that the generated target now holds content.
+func (p *Planner) markSynced(target string, content []byte) {
+	if p.Synced == "" {
+		return
+	}
+	m := p.synced()
+	m[target] = hash(content)
+	p.saveSynced(m)
+}
+
+// forgetSynced drops the record for target, so that it is treated as
+// edited rather than stale until it is written again.
+func (p *Planner) forgetSynced(target string) {
+	if p.Synced == "" {
+		return
+	}
+	m := p.synced()
+	delete(m, target)
+	p.saveSynced(m)
+}
+
+// replacedLink refines st, a file in the way of the symlinked entry e: if
+// LazyDots linked the target before, the link was most likely replaced by
+// an editor or app saving the file, which is drift rather than a foreign
+// file.
+func (p *Planner) replacedLink(e Entry, st state) state {
+	if _, ok := p.synced()[e.Target]; !ok {
+		return st
+	}
+	info, err := os.Lstat(e.Target)
+	if err != nil || !info.Mode().IsRegular() {
+		return st
+	}
+	got, err := os.ReadFile(e.Target)
+	if err != nil {
+		return st
+	}
+	if want, err := os.ReadFile(e.Source); err == nil && bytes.Equal(got, want) {
+		return conflict(ConflictDrift, "link was replaced by a file with the same contents")
+	}
+	return conflict(ConflictDrift, "link was replaced by a file with different contents")
+}
+
+func (p *Planner) saveSynced(m map[string]string) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return
+	}
+	if os.MkdirAll(filepath.Dir(p.Synced), 0o755) == nil {
+		os.WriteFile(p.Synced, data, 0o644)
+	}
+}
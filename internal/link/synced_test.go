@@ -0,0 +1,61 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReplacedLink(t *testing.T) {
+	root, home := testRepo(t)
+	src := filepath.Join(root, "app", ".apprc")
+	writeFile(t, src, "repo\n")
+	p := NewPlanner(root, home)
+	p.Synced = filepath.Join(t.TempDir(), "synced.json")
+	e := NewEngine(p)
+	target := filepath.Join(home, ".apprc")
+
+	entries, err := e.Scan(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+
+	// An app saving the file replaces the link.
+	if err := os.Remove(target); err != nil {
+		t.Fatalf("failed to remove link: %v", err)
+	}
+	writeFile(t, target, "home\n")
+	entry := e.Refresh(entries[0])
+	if entry.Conflict != ConflictDrift {
+		t.Fatalf("Refresh() conflict = %v (%s), want drift", entry.Conflict, entry.Reason)
+	}
+
+	if _, err := e.Resolve(entry, ResolveAdopt); err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(src); string(got) != "home\n" {
+		t.Errorf("source after adopt = %q, want the home version", got)
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after adopt = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+}
+
+func TestUnrecordedFileIsNotDrift(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "app", ".apprc"), "repo\n")
+	writeFile(t, filepath.Join(home, ".apprc"), "home\n")
+	p := NewPlanner(root, home)
+	p.Synced = filepath.Join(t.TempDir(), "synced.json")
+
+	entries, err := p.Scan(filepath.Join(root, "app"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if entries[0].Conflict != ConflictFile {
+		t.Errorf("Scan() conflict = %v, want file", entries[0].Conflict)
+	}
+}
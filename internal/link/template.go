@@ -0,0 +1,49 @@
+package link
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// TemplateSuffix marks package files that are rendered into their target
+// instead of linked, when templates are enabled. The suffix is dropped
+// from the target name: "dot-gitconfig.tmpl" -> "~/.gitconfig".
+const TemplateSuffix = ".tmpl"
+
+// TemplateData is what templates are rendered with, e.g.
+// {{ .Hostname }} or {{ .Vars.email }}.
+type TemplateData struct {
+	Hostname string
+	OS       string // runtime.GOOS, e.g. "linux"
+	Arch     string // runtime.GOARCH, e.g. "amd64"
+	User     string
+	Home     string
+	Profile  string            // active profile, or ""
+	Vars     map[string]string // user-defined variables from the config
+}
+
+// isTemplate reports whether the package file at rel is rendered rather
+// than linked.
+func (p *Planner) isTemplate(rel string) bool {
+	return p.Templates && strings.HasSuffix(rel, TemplateSuffix) && len(rel) > len(TemplateSuffix)
+}
+
+// Render renders the template at src with the planner's TemplateData.
+// Unknown variables are errors rather than "<no value>".
+func (p *Planner) Render(src string) ([]byte, error) {
+	text, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(src).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, p.TemplateData); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,153 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func templatePlanner(root, home string) *Planner {
+	p := NewPlanner(root, home)
+	p.Templates = true
+	p.TemplateData = TemplateData{Hostname: "laptop", OS: "linux", Vars: map[string]string{"email": "me@example.com"}}
+	return p
+}
+
+func TestTemplateTarget(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig.tmpl"), "email = {{ .Vars.email }}\n")
+
+	entries, err := templatePlanner(root, home).Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Target != filepath.Join(home, ".gitconfig") || !entries[0].Template {
+		t.Fatalf("Scan() = %+v, want a template entry for .gitconfig", entries)
+	}
+
+	// Without templates enabled the file is linked as is.
+	entries, err = NewPlanner(root, home).Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if entries[0].Target != filepath.Join(home, ".gitconfig.tmpl") || entries[0].Template {
+		t.Errorf("Scan() without templates = %+v, want a plain entry", entries[0])
+	}
+}
+
+func TestTemplateLinkAndUnlink(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig.tmpl"), "host = {{ .Hostname }}\nemail = {{ .Vars.email }}\n")
+	e := NewEngine(templatePlanner(root, home))
+	target := filepath.Join(home, ".gitconfig")
+
+	entries, err := e.Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	plan := e.PlanLink(entries)
+	if len(plan.Actions) != 1 || plan.Actions[0].Kind != ActionRender {
+		t.Fatalf("PlanLink() = %+v, want one render", plan.Actions)
+	}
+	if res := e.Apply(plan); len(res.Errors) > 0 {
+		t.Fatalf("Apply() errors: %v", res.Errors)
+	}
+	got, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatalf("ReadFile() unexpected error: %v", err)
+	}
+	if want := "host = laptop\nemail = me@example.com\n"; string(got) != want {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+	if entry := e.Refresh(entries[0]); entry.Status != StatusLinked {
+		t.Errorf("status after render = %v (%s), want linked", entry.Status, entry.Reason)
+	}
+	if plan := e.PlanLink(entries); plan.Unchanged != 1 || len(plan.Actions) != 0 {
+		t.Errorf("PlanLink() again = %+v, want unchanged", plan)
+	}
+
+	if err := e.Unlink(entries[0]); err != nil {
+		t.Fatalf("Unlink() unexpected error: %v", err)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Errorf("rendered file still exists after unlink: %v", err)
+	}
+}
+
+func TestTemplateDrift(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig.tmpl"), "host = {{ .Hostname }}\n")
+	e := NewEngine(templatePlanner(root, home))
+	target := filepath.Join(home, ".gitconfig")
+	writeFile(t, target, "host = edited\n")
+
+	entries, err := e.Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if entries[0].Conflict != ConflictDrift {
+		t.Fatalf("Scan() conflict = %v, want drift", entries[0].Conflict)
+	}
+	if plan := e.PlanUnlink(entries); len(plan.Actions) != 0 {
+		t.Errorf("PlanUnlink() = %+v, want the edited file left alone", plan.Actions)
+	}
+
+	b, err := e.Resolve(entries[0], ResolveBackup)
+	if err != nil {
+		t.Fatalf("Resolve() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "host = laptop\n" {
+		t.Errorf("after Resolve() target = %q, want the rendered template", got)
+	}
+	if err := e.Restore(b); err != nil {
+		t.Fatalf("Restore() unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "host = edited\n" {
+		t.Errorf("after Restore() target = %q, want the edited file back", got)
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig.tmpl"), "{{ .Nope }}\n")
+	p := templatePlanner(root, home)
+
+	entries, err := p.Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	plan := p.PlanLink(entries)
+	if len(plan.Actions) != 1 || plan.Actions[0].Kind != ActionSkip || !strings.Contains(plan.Actions[0].Reason, "template error") {
+		t.Errorf("PlanLink() = %+v, want a template error skip", plan.Actions)
+	}
+
+	writeFile(t, filepath.Join(home, ".gitconfig"), "")
+	if entry := p.Refresh(entries[0]); entry.Conflict != ConflictTemplate {
+		t.Errorf("Refresh() conflict = %v, want template-error", entry.Conflict)
+	}
+}
+
+func TestRemoveRenderedRefusesEdits(t *testing.T) {
+	root, home := testRepo(t)
+	writeFile(t, filepath.Join(root, "git", ".gitconfig.tmpl"), "host = {{ .Hostname }}\n")
+	e := NewEngine(templatePlanner(root, home))
+	target := filepath.Join(home, ".gitconfig")
+
+	entries, err := e.Scan(filepath.Join(root, "git"))
+	if err != nil {
+		t.Fatalf("Scan() unexpected error: %v", err)
+	}
+	if err := e.Link(entries[0]); err != nil {
+		t.Fatalf("Link() unexpected error: %v", err)
+	}
+	plan := e.PlanUnlink(entries)
+	writeFile(t, target, "host = edited\n")
+
+	if res := e.Apply(plan); len(res.Errors) == 0 {
+		t.Fatal("Apply() removed an edited rendered file")
+	}
+	if got, _ := os.ReadFile(target); string(got) != "host = edited\n" {
+		t.Errorf("target = %q, want the edits kept", got)
+	}
+}
@@ -0,0 +1,437 @@
+package link
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nodeKind is what the planner believes is at a target path.
+type nodeKind int
+
+const (
+	nodeNone  nodeKind = iota // nothing there
+	nodeDir                   // a real directory
+	nodeLink                  // a symlink
+	nodeFile                  // a regular file or anything else in the way
+	nodeError                 // the path could not be inspected
+)
+
+type node struct {
+	kind    nodeKind
+	dest    string // absolute symlink destination (nodeLink)
+	isDir   bool   // the symlink destination is a directory (nodeLink)
+	fresh   bool   // directory created by the plan, so all its children are virtual (nodeDir)
+	planned int    // 1 + index of the action creating this folded symlink, or 0
+	err     error  // nodeError
+}
+
+// tree simulates the target directory while a plan is built, so later
+// actions see the effect of earlier ones without anything on disk changing.
+// It implements Stow-style tree folding: a directory whose target doesn't
+// exist is linked as a whole, and a directory symlink into the repository
+// is split apart ("unfolded") when another package needs to add to it.
+type tree struct {
+	p       *Planner
+	plan    Plan
+	nodes   map[string]node   // virtual state, overriding the disk
+	pending map[string]Action // symlinks recreated by unfolding, emitted last
+	order   []string          // insertion order of pending
+}
+
+func newTree(p *Planner) *tree {
+	return &tree{p: p, nodes: map[string]node{}, pending: map[string]Action{}}
+}
+
+// stat returns the virtual state of path.
+func (t *tree) stat(path string) node {
+	if n, ok := t.nodes[path]; ok {
+		return n
+	}
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if n, ok := t.nodes[dir]; ok {
+			switch {
+			case n.kind == nodeNone, n.kind == nodeDir && n.fresh:
+				// Created or removed by the plan: nothing below it yet.
+				return node{kind: nodeNone}
+			case n.kind == nodeLink:
+				// Planned symlink: look at what it will point to.
+				rest, _ := filepath.Rel(dir, path)
+				return statDisk(filepath.Join(n.dest, rest))
+			}
+		}
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	return statDisk(path)
+}
+
+func statDisk(path string) node {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) || errors.Is(err, fs.ErrNotExist) {
+		return node{kind: nodeNone}
+	}
+	if err != nil {
+		return node{kind: nodeError, err: err}
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		dest, err := readLink(path)
+		if err != nil {
+			return node{kind: nodeError, err: err}
+		}
+		st, err := os.Stat(path)
+		return node{kind: nodeLink, dest: dest, isDir: err == nil && st.IsDir()}
+	case info.IsDir():
+		return node{kind: nodeDir}
+	}
+	return node{kind: nodeFile}
+}
+
+// owned reports whether dest points into the dotfiles repository.
+func (t *tree) owned(dest string) bool {
+	return t.p.Root != "" && within(dest, t.p.Root)
+}
+
+func (t *tree) add(a Action) int {
+	t.plan.Actions = append(t.plan.Actions, a)
+	return len(t.plan.Actions) - 1
+}
+
+func (t *tree) skip(e Entry, reason string) {
+	t.add(Action{Kind: ActionSkip, Path: e.Target, Source: e.Source, Rel: e.Rel, Reason: reason})
+}
+
+// link plans the actions to link e, walking down from the filesystem root
+// to the target's parent directory.
+func (t *tree) link(e Entry) {
+	var dirs []string
+	for dir := filepath.Dir(e.Target); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dir := dirs[i]
+		n := t.stat(dir)
+		switch n.kind {
+		case nodeNone:
+			if pkgDir, ok := t.foldable(e, dir); ok {
+				rel, _ := filepath.Rel(packageDir(e), pkgDir)
+				idx := t.add(Action{Kind: ActionSymlink, Path: dir, Source: pkgDir, Rel: rel, Count: 1, Relative: t.p.Relative})
+				t.nodes[dir] = node{kind: nodeLink, dest: pkgDir, isDir: true, planned: idx + 1}
+				return
+			}
+			t.add(Action{Kind: ActionMkdir, Path: dir})
+			t.nodes[dir] = node{kind: nodeDir, fresh: true}
+
+		case nodeDir:
+			// Existing directory, keep walking down.
+
+		case nodeLink:
+			rest, _ := filepath.Rel(dir, e.Target)
+			if samePath(filepath.Join(n.dest, rest), e.Source) {
+				if n.planned > 0 {
+					// Covered by a folded symlink planned for an earlier entry.
+					t.plan.Actions[n.planned-1].Count++
+				} else {
+					t.plan.Unchanged++
+				}
+				return
+			}
+			if !n.isDir {
+				t.skip(e, "parent is not a directory: "+dir)
+				return
+			}
+			if t.owned(n.dest) {
+				// Folded by another package: split it into per-entry links.
+				t.unfold(dir, n.dest)
+			}
+			// A foreign symlinked directory is used as is.
+
+		case nodeFile:
+			t.skip(e, "parent is not a directory: "+dir)
+			return
+
+		case nodeError:
+			t.skip(e, n.err.Error())
+			return
+		}
+	}
+
+	n := t.stat(e.Target)
+	if e.Generated() {
+		t.render(e, n)
+		return
+	}
+	switch n.kind {
+	case nodeNone:
+		t.add(Action{Kind: ActionSymlink, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1, Relative: t.p.Relative})
+		t.nodes[e.Target] = node{kind: nodeLink, dest: e.Source}
+	case nodeLink:
+		if samePath(n.dest, e.Source) {
+			t.plan.Unchanged++
+			return
+		}
+		t.skip(e, linkedElsewhere(t.p.Root, n.dest))
+	case nodeDir:
+		t.skip(e, "a directory is in the way")
+	case nodeFile:
+		t.skip(e, "target already exists and is not a symlink")
+	case nodeError:
+		t.skip(e, n.err.Error())
+	}
+}
+
+// render plans writing the output of the generated entry e to its target,
+// whose virtual state is n. A regular file already matching the output is
+// unchanged.
+func (t *tree) render(e Entry, n node) {
+	switch n.kind {
+	case nodeNone:
+		content, err := t.p.Output(e)
+		if err != nil {
+			t.skip(e, outputError(e, err).reason)
+			return
+		}
+		t.add(Action{Kind: ActionRender, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1, Generated: true, Content: content, Mode: outputMode(e)})
+		t.nodes[e.Target] = node{kind: nodeFile}
+	case nodeFile:
+		st := t.p.state(e)
+		switch {
+		case st.status == StatusLinked:
+			t.plan.Unchanged++
+		case st.conflict == ConflictStale:
+			// Only the source changed, so the target is safe to replace.
+			old, err := os.ReadFile(e.Target)
+			content, oerr := t.p.Output(e)
+			if err != nil || oerr != nil {
+				t.skip(e, st.reason)
+				return
+			}
+			t.add(Action{Kind: ActionRemove, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1, Generated: true, Content: old})
+			t.add(Action{Kind: ActionRender, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1, Generated: true, Content: content, Mode: outputMode(e)})
+		default:
+			t.skip(e, st.reason)
+		}
+	case nodeLink:
+		t.skip(e, linkedElsewhere(t.p.Root, n.dest))
+	case nodeDir:
+		t.skip(e, "a directory is in the way")
+	case nodeError:
+		t.skip(e, n.err.Error())
+	}
+}
+
+// packageDir returns the package directory e belongs to.
+func packageDir(e Entry) string {
+	return filepath.Clean(strings.TrimSuffix(e.Source, e.Rel))
+}
+
+// foldable reports whether the target directory dir can be created as a
+// single symlink to a directory of e's package, and returns that directory.
+// This requires folding to be enabled, and every file below the package
+// directory to be linked (not generated) to the same relative path below
+// dir.
+func (t *tree) foldable(e Entry, dir string) (string, bool) {
+	if !t.p.Fold {
+		return "", false
+	}
+	rest, err := filepath.Rel(dir, e.Target)
+	if err != nil || strings.HasPrefix(rest, "..") {
+		return "", false
+	}
+
+	// Strip as many components off e.Rel as e.Target has below dir.
+	pkgRel := e.Rel
+	for range strings.Split(rest, string(filepath.Separator)) {
+		pkgRel = filepath.Dir(pkgRel)
+	}
+	if pkgRel == "." || pkgRel == string(filepath.Separator) || t.p.TargetFor(e.Package, pkgRel) != dir {
+		// Never fold the package root itself.
+		return "", false
+	}
+
+	pkgPath := packageDir(e)
+	pkgDir := filepath.Join(pkgPath, pkgRel)
+	ig, err := t.p.Ignore(pkgPath)
+	if err != nil {
+		return "", false
+	}
+	ok := true
+	err = filepath.WalkDir(pkgDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(pkgPath, path)
+		if ig.Match(rel, d.IsDir()) {
+			// Folding would expose ignored files in the target.
+			ok = false
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if t.p.classify(Entry{Source: path}).Generated() {
+			// A rendered, decrypted or copied file needs a target of its own.
+			ok = false
+			return filepath.SkipAll
+		}
+		below, _ := filepath.Rel(pkgDir, path)
+		if t.p.TargetFor(e.Package, rel) != filepath.Join(dir, below) {
+			ok = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return pkgDir, ok && err == nil
+}
+
+// unfold replaces the directory symlink at dir (pointing to dest inside the
+// repository) with a real directory holding one symlink per child of dest.
+func (t *tree) unfold(dir, dest string) {
+	if _, ok := t.pending[dir]; ok {
+		// Recreated by an earlier unfold and not emitted yet: just drop it.
+		delete(t.pending, dir)
+	} else {
+		t.add(Action{Kind: ActionRemove, Path: dir, Source: dest})
+	}
+	t.add(Action{Kind: ActionMkdir, Path: dir})
+	t.nodes[dir] = node{kind: nodeDir, fresh: true}
+
+	children, _ := os.ReadDir(dest)
+	for _, c := range children {
+		path := filepath.Join(dir, c.Name())
+		target := filepath.Join(dest, c.Name())
+		st, err := os.Stat(target)
+		t.pending[path] = Action{Kind: ActionSymlink, Path: path, Source: target, Relative: t.p.Relative}
+		t.order = append(t.order, path)
+		t.nodes[path] = node{kind: nodeLink, dest: target, isDir: err == nil && st.IsDir()}
+	}
+}
+
+// unlink plans the removal of every linked entry. Entries linked through a
+// folded directory remove that directory symlink if they are all of its
+// contents, or unfold it around them otherwise.
+func (t *tree) unlink(entries []Entry) {
+	folds := map[string][]Entry{}
+	var vias []string
+	for _, e := range entries {
+		st := t.p.state(e)
+		via := st.via
+		if st.status != StatusLinked {
+			t.plan.Unchanged++
+			continue
+		}
+		if e.Generated() {
+			content, err := t.p.Output(e)
+			if err != nil {
+				t.skip(e, outputError(e, err).reason)
+				continue
+			}
+			t.add(Action{Kind: ActionRemove, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1, Generated: true, Content: content})
+			t.nodes[e.Target] = node{kind: nodeNone}
+			continue
+		}
+		if via == "" {
+			t.add(Action{Kind: ActionRemove, Path: e.Target, Source: e.Source, Rel: e.Rel, Count: 1})
+			t.nodes[e.Target] = node{kind: nodeNone}
+			continue
+		}
+		if _, ok := folds[via]; !ok {
+			vias = append(vias, via)
+		}
+		folds[via] = append(folds[via], e)
+	}
+
+	for _, via := range vias {
+		dest, err := readLink(via)
+		if err != nil {
+			for _, e := range folds[via] {
+				t.skip(e, err.Error())
+			}
+			continue
+		}
+		removed := map[string]bool{}
+		for _, e := range folds[via] {
+			removed[e.Target] = true
+		}
+
+		rel, _ := filepath.Rel(packageDir(folds[via][0]), dest)
+		t.add(Action{Kind: ActionRemove, Path: via, Source: dest, Rel: rel, Count: len(folds[via])})
+		t.nodes[via] = node{kind: nodeNone}
+		if !coversAll(via, dest, removed) {
+			t.refold(via, dest, removed)
+		}
+	}
+}
+
+// coversAll reports whether every file below dest, seen through the folded
+// symlink at dir, is in removed.
+func coversAll(dir, dest string, removed map[string]bool) bool {
+	all := true
+	filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			all = false
+			return filepath.SkipAll
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rest, _ := filepath.Rel(dest, path)
+		if !removed[filepath.Join(dir, rest)] {
+			all = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return all
+}
+
+// refold recreates dir as a real directory linking every child of dest
+// except the removed targets, descending into children that contain them.
+func (t *tree) refold(dir, dest string, removed map[string]bool) {
+	t.add(Action{Kind: ActionMkdir, Path: dir})
+	t.nodes[dir] = node{kind: nodeDir, fresh: true}
+
+	children, _ := os.ReadDir(dest)
+	for _, c := range children {
+		path := filepath.Join(dir, c.Name())
+		target := filepath.Join(dest, c.Name())
+		switch {
+		case removed[path]:
+			// Left out: this is what is being unlinked.
+		case c.IsDir() && containsAny(path, removed):
+			t.refold(path, target, removed)
+		default:
+			t.add(Action{Kind: ActionSymlink, Path: path, Source: target, Relative: t.p.Relative})
+			t.nodes[path] = node{kind: nodeLink, dest: target, isDir: c.IsDir()}
+		}
+	}
+}
+
+// containsAny reports whether any path in set is below dir.
+func containsAny(dir string, set map[string]bool) bool {
+	for path := range set {
+		if strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// finish emits the symlinks recreated by unfolding and returns the plan.
+func (t *tree) finish() Plan {
+	for _, path := range t.order {
+		if a, ok := t.pending[path]; ok {
+			t.plan.Actions = append(t.plan.Actions, a)
+			delete(t.pending, path)
+		}
+	}
+	return t.plan
+}
@@ -0,0 +1,283 @@
+package link
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// foldRepo creates an "nvim" package with a nested directory tree and an
+// existing ~/.config, and returns an engine with folding enabled.
+func foldRepo(t *testing.T) (e *Engine, root, home string) {
+	t.Helper()
+	root, home = testRepo(t)
+	writeFile(t, filepath.Join(root, "nvim", ".config", "nvim", "init.lua"), "")
+	writeFile(t, filepath.Join(root, "nvim", ".config", "nvim", "lua", "plugins.lua"), "")
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0o755); err != nil {
+		t.Fatalf("failed to create ~/.config: %v", err)
+	}
+
+	p := NewPlanner(root, home)
+	p.Fold = true
+	return NewEngine(p), root, home
+}
+
+func scan(t *testing.T, e *Engine, pkg string) []Entry {
+	t.Helper()
+	entries, err := e.Scan(pkg)
+	if err != nil {
+		t.Fatalf("Scan(%s) unexpected error: %v", pkg, err)
+	}
+	return entries
+}
+
+func TestFoldLinksWholeDirectory(t *testing.T) {
+	e, root, home := foldRepo(t)
+	pkg := filepath.Join(root, "nvim")
+
+	entries := scan(t, e, pkg)
+	plan := e.PlanLink(entries)
+	if got := kinds(plan); !equalKinds(got, []ActionKind{ActionSymlink}) {
+		t.Fatalf("PlanLink() kinds = %v, want a single folded symlink\n%s", got, plan)
+	}
+
+	res := e.Apply(plan)
+	if res.Done != 2 || len(res.Errors) != 0 {
+		t.Fatalf("Apply() = %+v, want 2 done", res)
+	}
+
+	dir := filepath.Join(home, ".config", "nvim")
+	if !isSymlinkTo(dir, filepath.Join(pkg, ".config", "nvim")) {
+		t.Fatalf("Apply() did not fold %s", dir)
+	}
+	for _, entry := range scan(t, e, pkg) {
+		if entry.Status != StatusLinked || entry.Via != dir {
+			t.Errorf("%s status = %v via %q, want linked via %s", entry.Rel, entry.Status, entry.Via, dir)
+		}
+	}
+
+	// Linking again changes nothing.
+	if plan := e.PlanLink(scan(t, e, pkg)); len(plan.Actions) != 0 || plan.Unchanged != 2 {
+		t.Errorf("second PlanLink() = %+v, want 2 unchanged", plan)
+	}
+}
+
+func TestUnfoldForSecondPackage(t *testing.T) {
+	e, root, home := foldRepo(t)
+	nvim := filepath.Join(root, "nvim")
+	extra := filepath.Join(root, "nvim-extra")
+	writeFile(t, filepath.Join(extra, ".config", "nvim", "after", "ftplugin", "go.lua"), "")
+
+	if res := e.Apply(e.PlanLink(scan(t, e, nvim))); len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink(nvim)) errors: %v", res.Errors)
+	}
+
+	res := e.Apply(e.PlanLink(scan(t, e, extra)))
+	if res.Done != 1 || len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink(nvim-extra)) = %+v, want 1 done", res)
+	}
+
+	dir := filepath.Join(home, ".config", "nvim")
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("%s was not unfolded into a real directory", dir)
+	}
+	if !isSymlinkTo(filepath.Join(dir, "init.lua"), filepath.Join(nvim, ".config", "nvim", "init.lua")) {
+		t.Errorf("unfolding did not relink init.lua")
+	}
+	if !isSymlinkTo(filepath.Join(dir, "lua"), filepath.Join(nvim, ".config", "nvim", "lua")) {
+		t.Errorf("unfolding did not keep lua/ folded")
+	}
+	if !isSymlinkTo(filepath.Join(dir, "after"), filepath.Join(extra, ".config", "nvim", "after")) {
+		t.Errorf("nvim-extra did not fold after/")
+	}
+
+	for _, pkg := range []string{nvim, extra} {
+		for _, entry := range scan(t, e, pkg) {
+			if entry.Status != StatusLinked {
+				t.Errorf("%s status = %v, want linked", entry.Rel, entry.Status)
+			}
+		}
+	}
+
+	// Nothing was written into the first package's directory.
+	if _, err := os.Lstat(filepath.Join(nvim, ".config", "nvim", "after")); !os.IsNotExist(err) {
+		t.Errorf("linking nvim-extra wrote into the nvim package")
+	}
+}
+
+func TestUnfoldWithoutFolding(t *testing.T) {
+	e, root, home := foldRepo(t)
+	e.Fold = false
+	nvim := filepath.Join(root, "nvim")
+	extra := filepath.Join(root, "nvim-extra")
+	writeFile(t, filepath.Join(extra, ".config", "nvim", "extra.lua"), "")
+
+	// A tree folded by stow itself.
+	symlink(t, filepath.Join(nvim, ".config", "nvim"), filepath.Join(home, ".config", "nvim"))
+
+	if res := e.Apply(e.PlanLink(scan(t, e, extra))); res.Done != 1 || len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink(nvim-extra)) = %+v, want 1 done", res)
+	}
+	if _, err := os.Lstat(filepath.Join(nvim, ".config", "nvim", "extra.lua")); !os.IsNotExist(err) {
+		t.Errorf("link was created inside the nvim package instead of unfolding")
+	}
+	for _, entry := range scan(t, e, nvim) {
+		if entry.Status != StatusLinked {
+			t.Errorf("%s status = %v after unfolding, want linked", entry.Rel, entry.Status)
+		}
+	}
+}
+
+func TestUnlinkFolded(t *testing.T) {
+	t.Run("whole package removes the folded link", func(t *testing.T) {
+		e, root, home := foldRepo(t)
+		pkg := filepath.Join(root, "nvim")
+		e.Apply(e.PlanLink(scan(t, e, pkg)))
+
+		plan := e.PlanUnlink(scan(t, e, pkg))
+		if got := kinds(plan); !equalKinds(got, []ActionKind{ActionRemove}) {
+			t.Fatalf("PlanUnlink() kinds = %v, want a single remove\n%s", got, plan)
+		}
+		if res := e.Apply(plan); res.Done != 2 {
+			t.Errorf("Apply() = %+v, want 2 done", res)
+		}
+		if _, err := os.Lstat(filepath.Join(home, ".config", "nvim")); !os.IsNotExist(err) {
+			t.Errorf("folded link still exists")
+		}
+	})
+
+	t.Run("single file unfolds around it", func(t *testing.T) {
+		e, root, home := foldRepo(t)
+		pkg := filepath.Join(root, "nvim")
+		e.Apply(e.PlanLink(scan(t, e, pkg)))
+
+		var initLua Entry
+		for _, entry := range scan(t, e, pkg) {
+			if filepath.Base(entry.Rel) == "init.lua" {
+				initLua = entry
+			}
+		}
+		if err := e.Unlink(initLua); err != nil {
+			t.Fatalf("Unlink() unexpected error: %v", err)
+		}
+
+		for _, entry := range scan(t, e, pkg) {
+			want := StatusLinked
+			if entry.Rel == initLua.Rel {
+				want = StatusMissing
+			}
+			if entry.Status != want {
+				t.Errorf("%s status = %v, want %v", entry.Rel, entry.Status, want)
+			}
+		}
+		if !isSymlinkTo(filepath.Join(home, ".config", "nvim", "lua"), filepath.Join(pkg, ".config", "nvim", "lua")) {
+			t.Errorf("sibling directory was not kept as a folded link")
+		}
+	})
+}
+
+func TestRestowFolded(t *testing.T) {
+	e, root, _ := foldRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	e.Apply(e.PlanLink(scan(t, e, pkg)))
+
+	res := e.Apply(e.PlanRestow(scan(t, e, pkg)))
+	if res.Done != 2 || len(res.Errors) != 0 {
+		t.Errorf("Apply(PlanRestow()) = %+v, want 2 done", res)
+	}
+	for _, entry := range scan(t, e, pkg) {
+		if entry.Status != StatusLinked {
+			t.Errorf("%s status = %v after restow, want linked", entry.Rel, entry.Status)
+		}
+	}
+}
+
+func TestFoldSkipsIgnoredContent(t *testing.T) {
+	e, root, home := foldRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, ".config", "nvim", "pack", "plugin", ".git", "HEAD"), "")
+	writeFile(t, filepath.Join(pkg, ".config", "nvim", "pack", "plugin", "plugin.vim"), "")
+
+	if res := e.Apply(e.PlanLink(scan(t, e, pkg))); len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+
+	dir := filepath.Join(home, ".config", "nvim")
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		t.Fatalf("%s was folded although it contains ignored files", dir)
+	}
+	if _, err := os.Lstat(filepath.Join(dir, "pack", "plugin", ".git")); !os.IsNotExist(err) {
+		t.Errorf("ignored .git directory is visible in the target")
+	}
+	if !isSymlinkTo(filepath.Join(dir, "lua"), filepath.Join(pkg, ".config", "nvim", "lua")) {
+		t.Errorf("clean sibling directory lua/ was not folded")
+	}
+}
+
+func TestFoldSkipsCopies(t *testing.T) {
+	e, root, home := foldRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	e.Copies = map[string]bool{"nvim": true}
+	e.Synced = filepath.Join(t.TempDir(), "synced.json")
+
+	if res := e.Apply(e.PlanLink(scan(t, e, pkg))); len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+	for _, dir := range []string{filepath.Join(home, ".config", "nvim"), filepath.Join(home, ".config", "nvim", "lua")} {
+		if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+			t.Fatalf("%s was folded although it holds copied files: %v", dir, err)
+		}
+	}
+	for _, rel := range []string{"init.lua", filepath.Join("lua", "plugins.lua")} {
+		path := filepath.Join(home, ".config", "nvim", rel)
+		if info, err := os.Lstat(path); err != nil || !info.Mode().IsRegular() {
+			t.Errorf("%s is not a copy: %v", path, err)
+		}
+	}
+}
+
+func TestFoldSkipsManifestCopy(t *testing.T) {
+	e, root, home := foldRepo(t)
+	pkg := filepath.Join(root, "nvim")
+	writeFile(t, filepath.Join(pkg, ManifestFile), `{"copy": [".config/nvim/lua/"]}`)
+	e.Synced = filepath.Join(t.TempDir(), "synced.json")
+
+	if res := e.Apply(e.PlanLink(scan(t, e, pkg))); len(res.Errors) != 0 {
+		t.Fatalf("Apply(PlanLink()) errors: %v", res.Errors)
+	}
+	dir := filepath.Join(home, ".config", "nvim")
+	if info, err := os.Lstat(filepath.Join(dir, "lua")); err != nil || !info.IsDir() {
+		t.Fatalf("lua/ was folded although it holds copied files: %v", err)
+	}
+	if info, err := os.Lstat(filepath.Join(dir, "lua", "plugins.lua")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("plugins.lua is not a copy: %v", err)
+	}
+	if !isSymlinkTo(filepath.Join(dir, "init.lua"), filepath.Join(pkg, ".config", "nvim", "init.lua")) {
+		t.Errorf("init.lua is not linked")
+	}
+}
+
+func TestFoldSkipsManifestSecrets(t *testing.T) {
+	root, home := testRepo(t)
+	pkg := filepath.Join(root, "sec")
+	src := filepath.Join(pkg, ".config", "tok", "token")
+	p := secretPlanner(t, root, home, src, "hunter2\n")
+	p.Fold = true
+	writeFile(t, filepath.Join(pkg, ManifestFile), `{"secrets": [".config/tok/token"]}`)
+	if err := os.MkdirAll(filepath.Join(home, ".config"), 0o755); err != nil {
+		t.Fatalf("failed to create ~/.config: %v", err)
+	}
+
+	plan := p.PlanLink(scan(t, NewEngine(p), pkg))
+	for _, a := range plan.Actions {
+		if a.Kind == ActionSymlink {
+			t.Errorf("PlanLink() links %s -> %s, want the secret decrypted\n%s", a.Path, a.Source, plan)
+		}
+	}
+	if res := NewEngine(p).Apply(plan); len(res.Errors) != 0 {
+		t.Fatalf("Apply() errors: %v", res.Errors)
+	}
+	if got := readFile(t, filepath.Join(home, ".config", "tok", "token")); got != "hunter2\n" {
+		t.Errorf("target = %q, want the decrypted secret", got)
+	}
+}
@@ -0,0 +1,224 @@
+package link
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// step records an action that changed the filesystem so it can be reverted.
+type step struct {
+	action Action
+	prev   string      // raw destination of a removed symlink
+	mode   os.FileMode // permissions of a removed generated file or directory
+}
+
+// do performs a single plan action. It returns nil if the action turned out
+// to be a no-op (e.g. the directory or correct symlink already exists).
+func do(a Action) (*step, error) {
+	switch a.Kind {
+	case ActionMkdir:
+		err := mkdir(a.Path, a.Mode)
+		if os.IsExist(err) {
+			if info, statErr := os.Stat(a.Path); statErr == nil && info.IsDir() {
+				return nil, nil
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mkdir failed: %w", err)
+		}
+		return &step{action: a}, nil
+
+	case ActionSymlink:
+		if _, err := os.Lstat(a.Path); err == nil {
+			if dest, err := readLink(a.Path); err == nil && samePath(a.Source, dest) {
+				// Already correctly linked
+				return nil, nil
+			}
+			return nil, fmt.Errorf("target appeared since planning: %s", a.Path)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("lstat failed: %w", err)
+		}
+		if err := os.Symlink(linkText(a), a.Path); err != nil {
+			return nil, fmt.Errorf("symlink failed: %w", err)
+		}
+		return &step{action: a}, nil
+
+	case ActionRender:
+		if _, err := os.Lstat(a.Path); err == nil {
+			if got, err := os.ReadFile(a.Path); err == nil && bytes.Equal(got, a.Content) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("target appeared since planning: %s", a.Path)
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("lstat failed: %w", err)
+		}
+		if err := writeNew(a.Path, a.Content, a.Mode); err != nil {
+			return nil, fmt.Errorf("render failed: %w", err)
+		}
+		return &step{action: a}, nil
+
+	case ActionRemove:
+		if a.Generated {
+			return removeGenerated(a)
+		}
+		info, err := os.Lstat(a.Path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("lstat failed: %w", err)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			return nil, fmt.Errorf("target is not a symlink: %s", a.Path)
+		}
+		dest, err := readLink(a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("readlink failed: %w", err)
+		}
+		if !samePath(a.Source, dest) {
+			return nil, fmt.Errorf("symlink points elsewhere, refusing to remove: %s", a.Path)
+		}
+		raw, err := os.Readlink(a.Path)
+		if err != nil {
+			return nil, fmt.Errorf("readlink failed: %w", err)
+		}
+		if err := os.Remove(a.Path); err != nil {
+			return nil, fmt.Errorf("remove failed: %w", err)
+		}
+		return &step{action: a, prev: raw}, nil
+
+	case ActionRmdir:
+		var mode os.FileMode
+		if info, err := os.Lstat(a.Path); err == nil {
+			mode = info.Mode().Perm()
+		}
+		err := os.Remove(a.Path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			if entries, rerr := os.ReadDir(a.Path); rerr == nil && len(entries) > 0 {
+				// Something else lives there now; leaving it is harmless.
+				return nil, nil
+			}
+			return nil, fmt.Errorf("rmdir failed: %w", err)
+		}
+		return &step{action: a, mode: mode}, nil
+
+	case ActionSkip:
+		return nil, fmt.Errorf("%s", a.Reason)
+	}
+	return nil, fmt.Errorf("unknown action %v", a.Kind)
+}
+
+// removeGenerated removes the rendered template or decrypted secret at
+// a.Path, provided it still holds a.Content.
+func removeGenerated(a Action) (*step, error) {
+	info, err := os.Lstat(a.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lstat failed: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("target is not a generated file: %s", a.Path)
+	}
+	got, err := os.ReadFile(a.Path)
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %w", err)
+	}
+	if !bytes.Equal(got, a.Content) {
+		return nil, fmt.Errorf("generated file was edited, refusing to remove: %s", a.Path)
+	}
+	if err := os.Remove(a.Path); err != nil {
+		return nil, fmt.Errorf("remove failed: %w", err)
+	}
+	return &step{action: a, mode: info.Mode().Perm()}, nil
+}
+
+// writeNew writes content to a new file at path with mode perm.
+func writeNew(path string, content []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// The umask may have narrowed perm.
+	return os.Chmod(path, perm)
+}
+
+// linkText returns what a symlink action writes into the link: the source
+// path, or with Relative set, the source relative to the link's directory.
+// The relative path is computed between the physical directories so it
+// still resolves when a parent of the link is itself a symlink.
+func linkText(a Action) string {
+	if !a.Relative {
+		return a.Source
+	}
+	from, to := filepath.Dir(a.Path), a.Source
+	if real, err := filepath.EvalSymlinks(from); err == nil {
+		from = real
+	}
+	if real, err := resolveDir(to); err == nil {
+		to = real
+	}
+	rel, err := filepath.Rel(from, to)
+	if err != nil {
+		return a.Source
+	}
+	return rel
+}
+
+// mkdir creates the directory path with mode, or 0755 if mode is zero. An
+// explicit mode is applied regardless of the umask.
+func mkdir(path string, mode os.FileMode) error {
+	if mode == 0 {
+		return os.Mkdir(path, 0o755)
+	}
+	if err := os.Mkdir(path, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// undo reverts a single applied step.
+func undo(s step) error {
+	switch s.action.Kind {
+	case ActionMkdir:
+		// Only succeeds if the directory is empty again, which it is once
+		// everything created inside it has been reverted.
+		return os.Remove(s.action.Path)
+	case ActionSymlink, ActionRender:
+		return os.Remove(s.action.Path)
+	case ActionRmdir:
+		return mkdir(s.action.Path, s.mode)
+	case ActionRemove:
+		if s.action.Generated {
+			return writeNew(s.action.Path, s.action.Content, s.mode)
+		}
+		return os.Symlink(s.prev, s.action.Path)
+	}
+	return nil
+}
+
+// rollback reverts steps in reverse order and returns any errors hit on
+// the way. It does not stop at the first failure.
+func rollback(steps []step) []error {
+	var errs []error
+	for i := len(steps) - 1; i >= 0; i-- {
+		if err := undo(steps[i]); err != nil {
+			errs = append(errs, fmt.Errorf("rollback of %s %s failed: %w", steps[i].action.Kind, steps[i].action.Path, err))
+		}
+	}
+	return errs
+}
@@ -2,13 +2,14 @@ package tui
 
 import (
 	"fmt"
-	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/anakafeel/LazyDots/internal/config"
 	"github.com/anakafeel/LazyDots/internal/git"
+	"github.com/anakafeel/LazyDots/internal/link"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -31,10 +32,20 @@ type model struct {
 
 	panes      [paneCount]Pane
 	focusIndex int
+	files      *filesPane // the entered package's files, shown in place of the detail pane
 
 	committing  bool
 	commitInput textinput.Model
 	statusMsg   string
+
+	engine      *link.Engine
+	owners      link.Owners // every target and the packages claiming it
+	pendingPlan *link.Plan  // batch plan shown in the detail pane, awaiting y/n
+	pendingVerb string      // "Link" or "Unlink"
+	pendingPkg  string      // package the pending plan applies to
+
+	profile        string // active profile, or "" if none applies
+	pendingProfile string // profile the pending plan switches to
 }
 
 func New(cfg config.Config, bannerColor string, width, height int) model {
@@ -51,10 +62,14 @@ func New(cfg config.Config, bannerColor string, width, height int) model {
 		width:       width,
 		height:      height,
 		commitInput: ti,
+		engine:      engineFor(cfg),
 	}
 
-	m.panes[paneStatus] = newStatusPane(repoName, cfg.DotfilesPath, gitStatus)
-	m.panes[panePackages] = newPackagesPane(cfg.DotfilesPath)
+	hostname, _ := os.Hostname()
+	m.profile = cfg.ActiveProfile(hostname)
+	m.panes[paneStatus] = newStatusPane(repoName, cfg.DotfilesPath, gitStatus, m.profile)
+	m.owners, _ = m.engine.Owners()
+	m.panes[panePackages] = newPackagesPane(cfg.DotfilesPath, m.owners)
 	m.panes[paneBranches] = newBranchesPane(gitStatus.Branch)
 	m.panes[paneCommits] = newCommitsPane()
 	m.panes[paneDetail] = newDetailPane()
@@ -68,6 +83,17 @@ func New(cfg config.Config, bannerColor string, width, height int) model {
 	return m
 }
 
+// engineFor returns the link engine for cfg. main refuses to start with a
+// config FromConfig rejects, and the TUI never makes one invalid, so an
+// error here is a bug.
+func engineFor(cfg config.Config) *link.Engine {
+	engine, err := link.FromConfig(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return engine
+}
+
 func (m model) Init() tea.Cmd { return nil }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -111,29 +137,60 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+		// A pending link plan intercepts all keys until confirmed or cancelled
+		if m.pendingPlan != nil {
+			switch msg.String() {
+			case "y", "enter":
+				res := m.engine.Apply(*m.pendingPlan)
+				m.statusMsg = m.pendingPkg + ": " + resultMessage(m.pendingVerb, res)
+				if m.pendingProfile != "" && len(res.Errors) == 0 {
+					m.setProfile(m.pendingProfile)
+				}
+				m.pendingPlan, m.pendingProfile = nil, ""
+				m.owners, _ = m.engine.Owners()
+			case "n", "esc", "q":
+				m.pendingPlan, m.pendingProfile = nil, ""
+				m.statusMsg = "Cancelled"
+			}
+			m.syncDetail()
+			return m, nil
+		}
+
+		// A focused files pane gets every key but ctrl+c and, while no
+		// dialog or input is open, the ones switching panes
+		if m.files != nil && m.focusIndex == paneDetail {
+			key := msg.String()
+			switch {
+			case key == "ctrl+c":
+				return m, tea.Quit
+			case m.files.Capturing():
+				return m, m.files.Update(msg)
+			case key == "esc" || key == "q":
+				if m.files.Back() {
+					m.closeFiles()
+				}
+				return m, nil
+			case !switchesPane(key):
+				return m, m.files.Update(msg)
+			}
+		}
+
 		// Global keys
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
 		case "tab":
-			m.panes[m.focusIndex].Blur()
-			m.focusIndex = (m.focusIndex + 1) % paneCount
-			m.panes[m.focusIndex].Focus()
-			m.syncDetail()
+			m.focus((m.focusIndex + 1) % paneCount)
 			return m, nil
 		case "shift+tab":
-			m.panes[m.focusIndex].Blur()
-			m.focusIndex = (m.focusIndex - 1 + paneCount) % paneCount
-			m.panes[m.focusIndex].Focus()
-			m.syncDetail()
+			m.focus((m.focusIndex - 1 + paneCount) % paneCount)
 			return m, nil
 		case "1", "2", "3", "4", "5":
-			idx := int(msg.String()[0] - '1')
-			m.panes[m.focusIndex].Blur()
-			m.focusIndex = idx
-			m.panes[m.focusIndex].Focus()
-			m.syncDetail()
+			m.focus(int(msg.String()[0] - '1'))
 			return m, nil
+		case "l":
+			// The full-screen package list
+			return NewPackageListModel(m.cfg, m.bannerColor, m.width, m.height), nil
 		case "c":
 			m.committing = true
 			m.commitInput.Width = m.width - 12
@@ -148,6 +205,27 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			m.refreshGit()
 			return m, nil
+		case "u", "ctrl+r":
+			// Undo (or redo) the most recent operation from the journal
+			step, verb := m.engine.Undo, "Undo"
+			if msg.String() == "ctrl+r" {
+				step, verb = m.engine.Redo, "Redo"
+			}
+			m.statusMsg = historyMessage(verb, step)
+			m.owners, _ = m.engine.Owners()
+			if m.files != nil {
+				m.files.Reload()
+			}
+			m.syncDetail()
+			return m, nil
+		case "s":
+			// Plan switching to the next profile
+			m.planNextProfile()
+			return m, nil
+		case "d":
+			// Look for broken symlinks left behind in the target tree
+			doctor := NewDoctorModel(m.cfg, m.bannerColor, m.width, m.height)
+			return doctor, doctor.Init()
 		case "P":
 			if err := git.Pull(m.cfg.DotfilesPath); err != nil {
 				m.statusMsg = err.Error()
@@ -158,8 +236,29 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
+		// Package pane actions
+		if m.focusIndex == panePackages {
+			switch msg.String() {
+			case "enter":
+				m.openFiles()
+				return m, nil
+			case "a":
+				m.planPackage("Link")
+				return m, nil
+			case "A":
+				m.planPackage("Unlink")
+				return m, nil
+			}
+		}
+
 		// Delegate to focused pane
 		cmd := m.panes[m.focusIndex].Update(msg)
+		if m.files != nil && m.focusIndex == panePackages {
+			// Moving to another package leaves the entered one
+			if sel := m.panes[panePackages].(*packagesPane).Selected(); sel == nil || sel.name != m.files.name {
+				m.closeFiles()
+			}
+		}
 		m.syncDetail()
 		return m, cmd
 	}
@@ -167,6 +266,54 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// switchesPane reports whether key moves the focus to another pane.
+func switchesPane(key string) bool {
+	switch key {
+	case "tab", "shift+tab", "1", "2", "3", "4", "5":
+		return true
+	}
+	return false
+}
+
+// focus moves the focus to the pane at idx.
+func (m *model) focus(idx int) {
+	m.panes[m.focusIndex].Blur()
+	m.focusIndex = idx
+	m.panes[m.focusIndex].Focus()
+	m.syncDetail()
+}
+
+// openFiles enters the selected package: its files replace the preview in
+// the detail pane, which takes the focus.
+func (m *model) openFiles() {
+	sel := m.panes[panePackages].(*packagesPane).Selected()
+	if sel == nil {
+		return
+	}
+	m.files = newFilesPane(m.cfg, m.engine, sel.name, sel.path)
+	m.panes[paneDetail] = m.files
+	m.statusMsg = ""
+	m.focus(paneDetail)
+}
+
+// closeFiles puts the detail pane back in place of the files pane, moving
+// the focus to the packages pane if it was there. What was linked in the
+// meantime shows up in the other panes.
+func (m *model) closeFiles() {
+	if m.files == nil {
+		return
+	}
+	m.files = nil
+	m.panes[paneDetail] = newDetailPane()
+	if m.focusIndex == paneDetail {
+		m.focusIndex = panePackages
+		m.panes[panePackages].Focus()
+	}
+	m.owners, _ = m.engine.Owners()
+	m.refreshGit()
+	m.syncDetail()
+}
+
 func (m model) refreshGit() {
 	gs := git.GetStatus(m.cfg.DotfilesPath)
 	if sp, ok := m.panes[paneStatus].(*statusPane); ok {
@@ -177,12 +324,86 @@ func (m model) refreshGit() {
 	}
 }
 
+// planPackage computes a link or unlink plan for the selected package and
+// shows it in the detail pane for confirmation.
+func (m *model) planPackage(verb string) {
+	pp := m.panes[panePackages].(*packagesPane)
+	sel := pp.Selected()
+	if sel == nil {
+		return
+	}
+
+	m.closeFiles()
+	var plan link.Plan
+	label := sel.name
+	if verb == "Link" {
+		var err error
+		if plan, label, err = planLinkPackage(m.engine, sel.name); err != nil {
+			m.statusMsg = err.Error()
+			return
+		}
+	} else {
+		entries, err := m.engine.Scan(sel.path)
+		if err != nil {
+			m.statusMsg = err.Error()
+			return
+		}
+		plan = m.engine.PlanUnlink(entries)
+	}
+	m.pendingPlan, m.pendingVerb, m.pendingPkg = &plan, verb, label
+	m.statusMsg = ""
+	m.syncDetail()
+}
+
+// planNextProfile plans applying the profile after the active one (by
+// name), linking its packages and unlinking all others, and shows the plan
+// in the detail pane for confirmation.
+func (m *model) planNextProfile() {
+	names := m.cfg.ProfileNames()
+	if len(names) == 0 {
+		m.statusMsg = "No profiles in config"
+		return
+	}
+	next := names[0]
+	if i := slices.Index(names, m.profile); i >= 0 {
+		next = names[(i+1)%len(names)]
+	}
+
+	m.closeFiles()
+	plan, _, err := m.engine.PlanProfile(m.cfg.Profiles[next].Packages)
+	if err != nil {
+		m.statusMsg = next + ": " + err.Error()
+		return
+	}
+	m.pendingPlan, m.pendingVerb, m.pendingPkg = &plan, "Switch", "profile "+next
+	m.pendingProfile = next
+	m.statusMsg = ""
+	m.syncDetail()
+}
+
+// setProfile makes name the active profile and saves it to the config.
+func (m *model) setProfile(name string) {
+	m.profile = name
+	m.cfg.Profile = name
+	if sp, ok := m.panes[paneStatus].(*statusPane); ok {
+		sp.profile = name
+	}
+	if err := config.Save(m.cfg); err != nil {
+		m.statusMsg = "Failed to save config: " + err.Error()
+	}
+}
+
 func (m model) syncDetail() {
 	dp, ok := m.panes[paneDetail].(*detailPane)
 	if !ok {
 		return
 	}
 
+	if m.pendingPlan != nil {
+		dp.SetContent(fmt.Sprintf("5 %s plan: %s", m.pendingVerb, m.pendingPkg), renderPlan(*m.pendingPlan))
+		return
+	}
+
 	switch m.focusIndex {
 	case panePackages:
 		pp := m.panes[panePackages].(*packagesPane)
@@ -193,7 +414,7 @@ func (m model) syncDetail() {
 		}
 		dp.SetContent(
 			fmt.Sprintf("5 %s", sel.name),
-			m.buildFilePreview(sel.path),
+			m.buildFilePreview(sel.name, sel.path),
 		)
 	case paneStatus:
 		dp.SetContent("5 Overview", m.buildOverview())
@@ -202,54 +423,45 @@ func (m model) syncDetail() {
 	}
 }
 
-func (m model) buildFilePreview(pkgPath string) string {
-	home, _ := os.UserHomeDir()
-	if home == "" {
-		home = "."
-	}
-
-	linked := lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+func (m model) buildFilePreview(name, pkgPath string) string {
+	linked := lipgloss.NewStyle().Foreground(colorLinked)
 	missing := lipgloss.NewStyle().Foreground(colorDim)
 	conflict := lipgloss.NewStyle().Foreground(colorHighlight)
 
-	var lines []string
-	_ = filepath.WalkDir(pkgPath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
-		}
-		if d.IsDir() {
-			return nil
-		}
-		rel, _ := filepath.Rel(pkgPath, path)
-
-		targetRel := rel
-		if !strings.HasPrefix(targetRel, ".") {
-			if i := strings.IndexRune(targetRel, os.PathSeparator); i != -1 {
-				targetRel = targetRel[i+1:]
-			}
-		}
-		targetPath := filepath.Join(home, targetRel)
-		status := computeLinkStatus(path, targetPath)
+	entries, _ := m.engine.Scan(pkgPath)
 
+	var lines []string
+	if meta := renderManifest(pkgPath); meta != "" {
+		lines = append(lines, meta, "")
+	}
+	for _, e := range entries {
 		var icon string
-		switch status {
-		case StatusLinked:
+		switch e.Status {
+		case link.StatusLinked:
 			icon = linked.Render("✓")
-		case StatusMissing:
+		case link.StatusMissing:
 			icon = missing.Render("○")
-		case StatusConflict:
+		case link.StatusConflict:
 			icon = conflict.Render("!")
 		}
 
-		lines = append(lines, fmt.Sprintf(" %s %s", icon, rel))
-		return nil
-	})
+		lines = append(lines, fmt.Sprintf(" %s %s", icon, e.Rel))
+	}
 
-	if len(lines) == 0 {
-		return " No files in this package"
+	if len(entries) == 0 {
+		lines = append(lines, " No files in this package")
+	}
+
+	if shared := m.owners.Shared(name); len(shared) > 0 {
+		warn := lipgloss.NewStyle().Foreground(colorWarn)
+		lines = append(lines, "", " "+warn.Render("Shares targets with other packages:"))
+		for _, target := range shared {
+			line := fmt.Sprintf("   %s (%s)", target, strings.Join(m.owners.Claims(target), ", "))
+			if owner := m.owners.Owner(target); owner != "" {
+				line += " — linked to " + owner
+			}
+			lines = append(lines, line)
+		}
 	}
 	return strings.Join(lines, "\n")
 }
@@ -263,6 +475,9 @@ func (m model) buildOverview() string {
 	var lines []string
 	lines = append(lines, " "+normal.Render(filepath.Base(m.cfg.DotfilesPath))+" "+gitStyle.Render(gs.FormatStatus()))
 	lines = append(lines, " "+dim.Render("Path:")+" "+normal.Render(m.cfg.DotfilesPath))
+	if m.profile != "" {
+		lines = append(lines, " "+dim.Render("Profile:")+" "+normal.Render(m.profile)+" "+dim.Render(strings.Join(m.cfg.Profiles[m.profile].Packages, ", ")))
+	}
 	lines = append(lines, "")
 
 	pp := m.panes[panePackages].(*packagesPane)
@@ -324,11 +539,21 @@ func (m model) renderFooter() string {
 		return padOrTruncate(line, w)
 	}
 
+	if m.pendingPlan != nil {
+		prompt := " " + planPrompt(m.pendingVerb, m.pendingPkg, *m.pendingPlan)
+		return padOrTruncate(lipgloss.NewStyle().Foreground(colorHighlight).Render(prompt), w)
+	}
+
 	if m.statusMsg != "" {
 		msg := " " + lipgloss.NewStyle().Foreground(colorHighlight).Render(m.statusMsg)
 		return padOrTruncate(msg, w)
 	}
 
-	hints := " tab:switch  ↑↓:navigate  1-5:pane  c:commit  p:push  P:pull  q:quit"
+	if m.files != nil && m.focusIndex == paneDetail {
+		hints := " space:toggle  enter:resolve  a/A:link/unlink all  R:relative  p:pull  +:add  /:filter  u/ctrl+r:undo/redo  esc:back"
+		return lipgloss.NewStyle().Foreground(colorDim).Render(padOrTruncate(hints, w))
+	}
+
+	hints := " tab:switch  ↑↓:navigate  1-5:pane  enter:files  a/A:link/unlink pkg  l:list  s:profile  u/ctrl+r:undo/redo  d:doctor  c:commit  p:push  P:pull  q:quit"
 	return lipgloss.NewStyle().Foreground(colorDim).Render(padOrTruncate(hints, w))
 }
@@ -0,0 +1,212 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/anakafeel/LazyDots/internal/git"
+	"github.com/anakafeel/LazyDots/internal/link"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// conflictIcons mark each kind of conflict in the file list.
+var conflictIcons = map[link.Conflict]string{
+	link.ConflictNone:       "⚠️",
+	link.ConflictFile:       "📄",
+	link.ConflictDir:        "📁",
+	link.ConflictPackage:    "🔀",
+	link.ConflictForeign:    "🔗",
+	link.ConflictUnreadable: "🔒",
+	link.ConflictDrift:      "✏️",
+	link.ConflictTemplate:   "🧩",
+	link.ConflictSecret:     "🔑",
+	link.ConflictStale:      "🔄",
+}
+
+// conflictChoices are the keys offered by the conflict dialog, in order.
+// Resolutions are only offered for the kinds of conflict they can resolve.
+var conflictChoices = []struct {
+	key  string
+	text string
+}{
+	{"b", "back up the existing file (timestamped) and link"},
+	{"o", "overwrite: move the existing file to the backup store and link"},
+	{"a", "adopt the existing file into the package (copies are pulled back, secrets re-encrypted)"},
+	{"d", "view diff first"},
+	{"esc", "cancel"},
+}
+
+// replacedChoices rename the choices for a link that was replaced by a
+// file, where adopting and overwriting are the natural fixes.
+var replacedChoices = map[string]string{
+	"a": "take the home version into the repo and restore the link",
+	"o": "restore the link (the home version goes to the backup store)",
+}
+
+// conflictResolutions maps dialog keys to resolutions.
+var conflictResolutions = map[string]link.Resolution{
+	"b": link.ResolveBackup,
+	"o": link.ResolveOverwrite,
+	"a": link.ResolveAdopt,
+}
+
+// renderConflict formats the conflict dialog for e.
+func renderConflict(e link.Entry) string {
+	title := lipgloss.NewStyle().Bold(true).Foreground(colorTitleFocus)
+	dim := lipgloss.NewStyle().Foreground(colorDim)
+	warn := lipgloss.NewStyle().Foreground(colorWarn)
+	key := lipgloss.NewStyle().Bold(true).Foreground(colorHighlight)
+
+	lines := []string{
+		" " + title.Render(conflictIcons[e.Conflict]+" Conflict: "+e.Rel),
+		"",
+		" " + e.Target,
+		" " + warn.Render(conflictMessage(e)),
+		" " + dim.Render(e.Reason),
+		"",
+	}
+	for _, c := range conflictChoices {
+		if !conflictOffers(e, c.key) {
+			continue
+		}
+		text := c.text
+		if replaced := replacedChoices[c.key]; replaced != "" && replacedLink(e) {
+			text = replaced
+		}
+		lines = append(lines, " "+key.Render(fmt.Sprintf("%-4s", c.key))+dim.Render(text))
+	}
+	if e.Conflict == link.ConflictTemplate {
+		lines = append(lines, "", " "+dim.Render("Fix the template in the package, then try again."))
+	} else if e.Conflict == link.ConflictSecret {
+		lines = append(lines, "", " "+dim.Render("Check the identity file in the config, then try again."))
+	} else if len(e.Conflict.Resolutions()) == 0 {
+		lines = append(lines, "", " "+dim.Render("Fix the permissions on the target by hand, then try again."))
+	} else {
+		lines = append(lines, "", " "+dim.Render("Every choice keeps a backup and can be undone with u."))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// replacedLink reports whether e is a symlinked file whose link was
+// replaced by a regular file.
+func replacedLink(e link.Entry) bool {
+	return e.Conflict == link.ConflictDrift && !e.Generated()
+}
+
+// conflictOffers reports whether the dialog offers key for the conflict on
+// e. Diffs need a file on both sides, and templates can't adopt.
+func conflictOffers(e link.Entry, key string) bool {
+	c := e.Conflict
+	switch key {
+	case "esc":
+		return true
+	case "d":
+		return c == link.ConflictFile || c == link.ConflictPackage || c == link.ConflictForeign || c == link.ConflictDrift || c == link.ConflictStale
+	}
+	how, ok := conflictResolutions[key]
+	if how == link.ResolveAdopt && e.Template {
+		return false
+	}
+	return ok && slices.Contains(c.Resolutions(), how)
+}
+
+// conflictDiff diffs e's target against what linking would put there: the
+// package file (also for copies), or for a template or secret its output.
+func conflictDiff(engine *link.Engine, e link.Entry) (string, error) {
+	if !e.Template && !e.Secret {
+		return git.DiffFiles(e.Target, e.Source)
+	}
+	content, err := engine.Output(e)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp("", "lazydots-*-"+filepath.Base(e.Target))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(content)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	return git.DiffFiles(e.Target, f.Name())
+}
+
+// conflictMessage says in plain words what is in the way of e's target.
+func conflictMessage(e link.Entry) string {
+	switch e.Conflict {
+	case link.ConflictFile:
+		return "A file is in the way of " + e.Rel
+	case link.ConflictDir:
+		return "A directory is in the way of " + e.Rel
+	case link.ConflictPackage:
+		return e.Rel + " is linked to a different file in the repository"
+	case link.ConflictForeign:
+		return e.Rel + " is a symlink to somewhere outside the repository"
+	case link.ConflictUnreadable:
+		return e.Rel + " cannot be read"
+	case link.ConflictDrift:
+		switch {
+		case replacedLink(e):
+			return e.Rel + " was replaced by a regular file, breaking its link"
+		case e.Secret:
+			return e.Rel + " differs from its decrypted secret"
+		case e.Copy:
+			return e.Rel + " differs from its copy in the repository"
+		}
+		return e.Rel + " differs from its rendered template"
+	case link.ConflictTemplate:
+		return e.Rel + " is a template that cannot be rendered"
+	case link.ConflictSecret:
+		return e.Rel + " is a secret that cannot be decrypted"
+	case link.ConflictStale:
+		return e.Rel + " is out of date: its source in the repository changed"
+	}
+	return "Conflict on " + e.Rel
+}
+
+// renderDiff colours a unified diff.
+func renderDiff(diff string) string {
+	if strings.TrimSpace(diff) == "" {
+		return " " + lipgloss.NewStyle().Foreground(colorDim).Render("Files are identical")
+	}
+	add := lipgloss.NewStyle().Foreground(colorLinked)
+	del := lipgloss.NewStyle().Foreground(colorHighlight)
+	hunk := lipgloss.NewStyle().Foreground(colorGit)
+	dim := lipgloss.NewStyle().Foreground(colorDim)
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff "), strings.HasPrefix(line, "index "):
+			line = dim.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			line = hunk.Render(line)
+		case strings.HasPrefix(line, "+"):
+			line = add.Render(line)
+		case strings.HasPrefix(line, "-"):
+			line = del.Render(line)
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveMessage describes a resolution for the footer.
+func resolveMessage(b link.Backup) string {
+	switch b.Resolution {
+	case link.ResolveBackup:
+		return "Backed up to " + b.Path + " and linked (u: undo)"
+	case link.ResolveOverwrite:
+		return "Overwrote " + b.Target + ", old file kept at " + b.Path + " (u: undo)"
+	case link.ResolveAdopt:
+		return "Adopted " + b.Target + " into the package, old package file kept at " + b.Path + " (u: undo)"
+	}
+	return "Resolved " + b.Target
+}
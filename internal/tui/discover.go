@@ -0,0 +1,164 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/link"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+//
+// 🔹 Import wizard (shown after setup: pick home files to adopt)
+//
+
+type candidateItem struct {
+	link.Candidate
+	selected bool
+}
+
+func (c candidateItem) Title() string {
+	box := "[ ]"
+	if c.selected {
+		box = "[x]"
+	}
+	name := c.Rel
+	if c.IsDir {
+		name += "/"
+	}
+	return box + " " + name
+}
+
+func (c candidateItem) Description() string { return "→ " + c.Package }
+func (c candidateItem) FilterValue() string { return c.Package + " " + c.Rel }
+
+type discoverModel struct {
+	list   list.Model
+	cfg    config.Config
+	engine *link.Engine
+	done   bool
+	added  int      // files linked back from the repository
+	pkgs   int      // packages files were added to
+	errs   []string // candidates that could not be added
+}
+
+// NewDiscoverModel scans the home directory for unmanaged config and lets
+// the user pick entries to add to suggested packages in cfg's repository.
+func NewDiscoverModel(cfg config.Config) discoverModel {
+	home := link.DefaultTargetDir()
+	candidates, err := link.Discover(home, link.DiscoverOptions{Skip: cfg.DotfilesPath})
+
+	items := []list.Item{}
+	for _, c := range candidates {
+		items = append(items, candidateItem{Candidate: c})
+	}
+
+	l := list.New(items, list.NewDefaultDelegate(), 60, 20)
+	l.Title = "Import dotfiles (space: select, a: all, enter: add, esc: skip)"
+	switch {
+	case err != nil:
+		l.NewStatusMessage("⚠️ Failed to scan " + home + ": " + err.Error())
+	case len(items) == 0:
+		l.NewStatusMessage("No unmanaged config found in " + home)
+	}
+
+	return discoverModel{
+		list:   l,
+		cfg:    cfg,
+		engine: engineFor(cfg),
+	}
+}
+
+func (m discoverModel) Init() tea.Cmd { return nil }
+
+func (m discoverModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.list.SetSize(msg.Width, msg.Height)
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+
+		switch msg.String() {
+		case "ctrl+c", "esc", "q":
+			m.done = true
+			return m, tea.Quit
+
+		case " ", "space":
+			if it, ok := m.list.SelectedItem().(candidateItem); ok {
+				it.selected = !it.selected
+				m.list.SetItem(m.list.Index(), it)
+			}
+			return m, nil
+
+		case "a":
+			// Select everything, or nothing if everything is selected
+			all := true
+			for _, item := range m.list.Items() {
+				all = all && item.(candidateItem).selected
+			}
+			for i, item := range m.list.Items() {
+				it := item.(candidateItem)
+				it.selected = !all
+				m.list.SetItem(i, it)
+			}
+			return m, nil
+
+		case "enter":
+			m.adoptSelected()
+			m.done = true
+			return m, tea.Quit
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+// adoptSelected adds every selected candidate to its suggested package,
+// creating packages as needed.
+func (m *discoverModel) adoptSelected() {
+	pkgs := map[string]bool{}
+	for _, item := range m.list.Items() {
+		it := item.(candidateItem)
+		if !it.selected {
+			continue
+		}
+		entries, err := m.engine.Add(filepath.Join(m.cfg.DotfilesPath, it.Package), it.Path)
+		if err != nil {
+			m.errs = append(m.errs, fmt.Sprintf("%s: %v", it.Rel, err))
+			continue
+		}
+		m.added += len(entries)
+		pkgs[it.Package] = true
+	}
+	m.pkgs = len(pkgs)
+}
+
+func (m discoverModel) View() string {
+	if !m.done {
+		return m.list.View()
+	}
+
+	lines := []string{"✅ Config saved!"}
+	if m.added > 0 {
+		lines = append(lines, fmt.Sprintf("Added %d files to %d packages.", m.added, m.pkgs))
+	}
+	if len(m.errs) > 0 {
+		warn := lipgloss.NewStyle().Foreground(colorWarn)
+		lines = append(lines, "", warn.Render(fmt.Sprintf("%d could not be added:", len(m.errs))))
+		for _, e := range m.errs {
+			lines = append(lines, "  "+e)
+		}
+	}
+	lines = append(lines, "", "Restart LazyDots.")
+	return strings.Join(lines, "\n") + "\n"
+}
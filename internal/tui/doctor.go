@@ -0,0 +1,166 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/link"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+//
+// 🔹 Doctor (broken and orphaned symlinks in the target tree)
+//
+
+type orphanItem struct {
+	link.Orphan
+}
+
+func (o orphanItem) Title() string {
+	if o.Kind == link.OrphanBroken {
+		return "💔 " + o.Path
+	}
+	return "👻 " + o.Path
+}
+
+func (o orphanItem) Description() string {
+	if o.Kind == link.OrphanBroken {
+		return "→ " + o.Dest + " (missing)"
+	}
+	return "→ " + o.Dest + " (not in any package)"
+}
+
+func (o orphanItem) FilterValue() string { return o.Path }
+
+// doctorScanMsg carries the result of a scan started by rescan.
+type doctorScanMsg struct {
+	orphans []link.Orphan
+	err     error
+	status  string // shown once the list is replaced, unless the scan failed
+}
+
+type doctorModel struct {
+	list        list.Model
+	cfg         config.Config
+	engine      *link.Engine
+	bannerColor string
+	width       int
+	height      int
+}
+
+// NewDoctorModel lists symlinks into the repository that are broken or
+// belong to no package. The target directories are scanned by Init.
+func NewDoctorModel(cfg config.Config, bannerColor string, width, height int) doctorModel {
+	engine := engineFor(cfg)
+
+	if width == 0 {
+		width = 60
+	}
+	if height == 0 {
+		height = 20
+	}
+
+	l := list.New(nil, list.NewDefaultDelegate(), width, height)
+	l.Title = "Doctor (x: remove link, X: remove all, esc: back)"
+
+	m := doctorModel{
+		list:        l,
+		cfg:         cfg,
+		engine:      engine,
+		bannerColor: bannerColor,
+		width:       width,
+		height:      height,
+	}
+	// Spin until the first scan, started by Init, is done.
+	m.list.StartSpinner()
+	return m
+}
+
+func (m doctorModel) Init() tea.Cmd { return m.rescan("") }
+
+func (m doctorModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		m.list.SetSize(msg.Width, msg.Height)
+		return m, nil
+
+	case doctorScanMsg:
+		m.list.StopSpinner()
+		if msg.err != nil {
+			m.list.SetItems(nil)
+			m.list.NewStatusMessage("⚠️ " + msg.err.Error())
+			return m, nil
+		}
+		items := make([]list.Item, 0, len(msg.orphans))
+		for _, o := range msg.orphans {
+			items = append(items, orphanItem{o})
+		}
+		m.list.SetItems(items)
+		switch {
+		case msg.status != "":
+			m.list.NewStatusMessage(msg.status)
+		case len(items) == 0:
+			m.list.NewStatusMessage("✅ No broken or orphaned symlinks")
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.list.FilterState() == list.Filtering {
+			break
+		}
+
+		switch msg.String() {
+		case "q", "esc":
+			return New(m.cfg, m.bannerColor, m.width, m.height), nil
+
+		case "x", " ", "space":
+			it, ok := m.list.SelectedItem().(orphanItem)
+			if !ok {
+				break
+			}
+			if err := m.engine.Prune(it.Orphan); err != nil {
+				m.list.NewStatusMessage("⚠️ " + err.Error())
+				return m, nil
+			}
+			m.list.RemoveItem(m.list.Index())
+			m.list.NewStatusMessage("🗑️ Removed " + it.Path)
+			return m, nil
+
+		case "X":
+			removed, failed := 0, 0
+			for _, item := range m.list.Items() {
+				if err := m.engine.Prune(item.(orphanItem).Orphan); err != nil {
+					failed++
+				} else {
+					removed++
+				}
+			}
+			status := fmt.Sprintf("🗑️ Removed %d links", removed)
+			if failed > 0 {
+				status = fmt.Sprintf("⚠️ Removed %d links, %d could not be removed", removed, failed)
+			}
+			return m, m.rescan(status)
+		}
+	}
+
+	var cmd tea.Cmd
+	m.list, cmd = m.list.Update(msg)
+	return m, cmd
+}
+
+func (m doctorModel) View() string {
+	return m.list.View()
+}
+
+// rescan scans the target directories in the background, showing the
+// spinner until the result arrives as a doctorScanMsg.
+func (m *doctorModel) rescan(status string) tea.Cmd {
+	engine := m.engine
+	return tea.Batch(m.list.StartSpinner(), func() tea.Msg {
+		orphans, err := engine.Doctor()
+		return doctorScanMsg{orphans: orphans, err: err, status: status}
+	})
+}
@@ -1,27 +1,19 @@
 package tui
 
 import (
+	"errors"
 	"fmt"
-	"io/fs"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/fs"
+	"github.com/anakafeel/LazyDots/internal/link"
 	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-)
-
-//
-// 🔹 Link status for dotfiles
-//
-
-type LinkStatus int
-
-const (
-	StatusMissing  LinkStatus = iota // no file at target path
-	StatusLinked                     // symlink exists and points to this package file
-	StatusConflict                   // file exists but is not the right symlink / some other issue
+	"github.com/charmbracelet/lipgloss"
 )
 
 //
@@ -31,40 +23,52 @@ const (
 type packageItem struct {
 	name     string
 	fullPath string
+	overlaps []string // packages claiming some of the same targets
+	manifest link.Manifest
+}
+
+func (p packageItem) Title() string { return "📦 " + p.name }
+
+func (p packageItem) Description() string {
+	desc := p.fullPath
+	if p.manifest.Description != "" {
+		desc = p.manifest.Description
+	}
+	if len(p.overlaps) > 0 {
+		return desc + " — ⚠️ shares targets with " + strings.Join(p.overlaps, ", ")
+	}
+	return desc
 }
 
-func (p packageItem) Title() string       { return "📦 " + p.name }
-func (p packageItem) Description() string { return p.fullPath }
 func (p packageItem) FilterValue() string { return p.name }
 
 type packageListModel struct {
 	list        list.Model
+	cfg         config.Config
 	rootPath    string
 	bannerColor string
 	width       int
 	height      int
 }
 
-func NewPackageListModel(rootPath string, bannerColor string, width, height int) packageListModel {
+func NewPackageListModel(cfg config.Config, bannerColor string, width, height int) packageListModel {
 	items := []list.Item{}
+	rootPath := cfg.DotfilesPath
 
-	entries, err := os.ReadDir(rootPath)
+	pkgs, err := link.Packages(rootPath)
 	if err != nil {
 		items = append(items, packageItem{
 			name:     "❌ Failed to read dotfiles root",
 			fullPath: fmt.Sprintf("%v", err),
 		})
 	} else {
-		for _, e := range entries {
-			if !e.IsDir() {
-				continue
-			}
-			if e.Name() == ".git" {
-				// Hide git metadata from the package list
-				continue
-			}
-			full := filepath.Join(rootPath, e.Name())
-			items = append(items, packageItem{name: e.Name(), fullPath: full})
+		var overlaps map[string][]string
+		if owners, err := engineFor(cfg).Owners(); err == nil {
+			overlaps = owners.Overlaps()
+		}
+		for _, pkg := range pkgs {
+			manifest, _ := link.ReadManifest(pkg.Path)
+			items = append(items, packageItem{name: pkg.Name, fullPath: pkg.Path, overlaps: overlaps[pkg.Name], manifest: manifest})
 		}
 		if len(items) == 0 {
 			items = append(items, packageItem{
@@ -87,6 +91,7 @@ func NewPackageListModel(rootPath string, bannerColor string, width, height int)
 
 	return packageListModel{
 		list:        l,
+		cfg:         cfg,
 		rootPath:    rootPath,
 		bannerColor: bannerColor,
 		width:       width,
@@ -107,13 +112,13 @@ func (m packageListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "q", "esc":
-			return New(config.Config{DotfilesPath: m.rootPath}, m.bannerColor, m.width, m.height), nil
+			return New(m.cfg, m.bannerColor, m.width, m.height), nil
 
 		case "enter":
 			if it := m.list.SelectedItem(); it != nil {
 				if pkg, ok := it.(packageItem); ok {
 					// Jump into the file list for this package.
-					return NewFileListModel(pkg.fullPath, m.bannerColor, m.width, m.height), nil
+					return NewFileListModel(m.cfg, pkg.fullPath, m.bannerColor, m.width, m.height), nil
 				}
 			}
 		}
@@ -133,104 +138,90 @@ func (m packageListModel) View() string {
 //
 
 type fileItem struct {
-	name   string     // relative path within the package
-	status LinkStatus // link status at target path
-	target string     // resolved target path under $HOME
+	link.Entry
 }
 
 func (f fileItem) Title() string {
 	icon := "❔"
-	switch f.status {
-	case StatusMissing:
+	switch f.Status {
+	case link.StatusMissing:
 		icon = "⭕" // not linked
-	case StatusLinked:
+	case link.StatusLinked:
 		icon = "✅"
-	case StatusConflict:
-		icon = "⚠️"
+	case link.StatusConflict:
+		icon = conflictIcons[f.Conflict]
 	}
-	return icon + " " + f.name
+	return icon + " " + f.Rel
 }
 
 func (f fileItem) Description() string {
-	if f.target == "" {
+	if f.Target == "" {
 		return ""
 	}
-	return f.target
+	if f.Reason != "" {
+		return f.Target + " — " + f.Reason
+	}
+	if f.Via != "" {
+		return f.Target + " — via " + f.Via
+	}
+	if f.Template {
+		return f.Target + " — rendered"
+	}
+	if f.Secret {
+		return f.Target + " — decrypted"
+	}
+	if f.Copy {
+		return f.Target + " — copied"
+	}
+	return f.Target
 }
 
-func (f fileItem) FilterValue() string { return f.name }
+// FilterValue matches on the target too, so "dot-" files are found by
+// their real name.
+func (f fileItem) FilterValue() string { return f.Rel + " " + f.Target }
 
 type fileListModel struct {
 	list        list.Model
+	cfg         config.Config
+	engine      *link.Engine
+	pending     *link.Plan // batch plan awaiting confirmation
+	pendingVerb string     // "Link" or "Unlink"
+	conflict    *fileItem  // conflicted file the resolution dialog is open for
+	diff        *viewport.Model
+	adding      bool // the add-path prompt is open
+	addInput    textinput.Model
 	packagePath string
 	bannerColor string
 	width       int
 	height      int
 }
 
-func NewFileListModel(packagePath string, bannerColor string, width, height int) fileListModel {
+func NewFileListModel(cfg config.Config, packagePath string, bannerColor string, width, height int) fileListModel {
+	return newFileList(cfg, engineFor(cfg), packagePath, bannerColor, width, height)
+}
+
+// newFileList builds the file list for the package at packagePath on top
+// of engine, which the dashboard shares with its own panes.
+func newFileList(cfg config.Config, engine *link.Engine, packagePath string, bannerColor string, width, height int) fileListModel {
 	items := []list.Item{}
 
-	home, err := os.UserHomeDir()
+	entries, err := engine.Scan(packagePath)
 	if err != nil {
-		// Fallback to current directory if home cannot be determined
-		home = "."
-	}
-
-	err = filepath.WalkDir(packagePath, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip .git directory entirely.
-		if d.IsDir() && d.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
-		// Only list files, not directories.
-		if d.IsDir() {
-			return nil
-		}
-
-		rel, err := filepath.Rel(packagePath, path)
-		if err != nil {
-			rel = path
-		}
-
-		// --- Resolve target path under $HOME ---
-		// Basic heuristic for Stow-style layout:
-		//   e.g. "fish/.config/fish/config.fish" -> "~/.config/fish/config.fish"
-		targetRel := rel
-		if !strings.HasPrefix(targetRel, ".") {
-			if i := strings.IndexRune(targetRel, os.PathSeparator); i != -1 {
-				targetRel = targetRel[i+1:]
-			}
+		items = []list.Item{fileItem{link.Entry{
+			Rel:    fmt.Sprintf("❌ Failed to scan package: %v", err),
+			Status: link.StatusConflict,
+		}}}
+	} else {
+		for _, e := range entries {
+			items = append(items, fileItem{e})
 		}
-		targetPath := filepath.Join(home, targetRel)
-
-		status := computeLinkStatus(path, targetPath)
-
-		items = append(items, fileItem{
-			name:   rel,
-			status: status,
-			target: targetPath,
-		})
-
-		return nil
-	})
-
-	if err != nil {
-		items = []list.Item{fileItem{
-			name:   fmt.Sprintf("❌ Failed to scan package: %v", err),
-			status: StatusConflict,
-		}}
 	}
 
 	if len(items) == 0 {
-		items = append(items, fileItem{
-			name:   "⚠️ No files found in this package",
-			status: StatusMissing,
-		})
+		items = append(items, fileItem{link.Entry{
+			Rel:    "⚠️ No files found in this package",
+			Status: link.StatusMissing,
+		}})
 	}
 
 	if width == 0 {
@@ -241,10 +232,17 @@ func NewFileListModel(packagePath string, bannerColor string, width, height int)
 	}
 
 	l := list.New(items, list.NewDefaultDelegate(), width, height)
-	l.Title = fmt.Sprintf("Files in %s (space: toggle, a/A: link/unlink all)", filepath.Base(packagePath))
+	l.Title = fmt.Sprintf("Files in %s (space: toggle, enter: resolve, +: add, a/A: link/unlink all, u: undo)", filepath.Base(packagePath))
+
+	ti := textinput.New()
+	ti.Placeholder = "~/.config/foo/bar.conf"
+	ti.CharLimit = 4096
 
 	return fileListModel{
 		list:        l,
+		cfg:         cfg,
+		engine:      engine,
+		addInput:    ti,
 		packagePath: packagePath,
 		bannerColor: bannerColor,
 		width:       width,
@@ -263,11 +261,32 @@ func (m fileListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
+		// A pending plan intercepts all keys until confirmed or cancelled
+		if m.pending != nil {
+			switch msg.String() {
+			case "y", "enter":
+				m.applyPending()
+			case "n", "esc", "q":
+				m.pending = nil
+				m.list.NewStatusMessage("Cancelled")
+			}
+			return m, nil
+		}
+
+		// The conflict dialog (and its diff view) intercepts all keys
+		if m.conflict != nil {
+			return m.updateConflict(msg)
+		}
+
+		// The add-path prompt intercepts all keys
+		if m.adding {
+			return m.updateAdd(msg)
+		}
+
 		switch msg.String() {
 		case "q", "esc":
 			// Go back to package list.
-			root := filepath.Dir(m.packagePath)
-			return NewPackageListModel(root, m.bannerColor, m.width, m.height), nil
+			return NewPackageListModel(m.cfg, m.bannerColor, m.width, m.height), nil
 
 		case " ", "space":
 			// Toggle link/unlink for the selected file (like lazygit's space to stage)
@@ -277,60 +296,136 @@ func (m fileListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 
 			it, ok := m.list.Items()[idx].(fileItem)
-			if !ok {
+			if !ok || it.Source == "" {
 				break
 			}
-
-			src := filepath.Join(m.packagePath, it.name)
-			var err error
-
-			switch it.status {
-			case StatusLinked:
-				// Currently linked → try to unlink
-				err = unlinkDotfile(src, it.target)
-			case StatusMissing, StatusConflict:
-				// Not linked or conflicting → try to link
-				err = linkDotfile(src, it.target)
+			if it.Status == link.StatusConflict && it.Conflict != link.ConflictStale {
+				// Offer to resolve instead of failing
+				m.conflict = &it
+				return m, nil
 			}
 
+			err := m.engine.Toggle(it.Entry)
+
 			// Recompute status after operation
-			newStatus := computeLinkStatus(src, it.target)
-			it.status = newStatus
+			it.Entry = m.engine.Refresh(it.Entry)
 			m.list.SetItem(idx, it)
 
 			// Show a status message in the footer (like lazygit)
 			if err != nil {
 				m.list.NewStatusMessage("⚠️ " + err.Error())
 			} else {
-				switch newStatus {
-				case StatusLinked:
-					m.list.NewStatusMessage("✅ Linked " + it.name)
-				case StatusMissing:
-					m.list.NewStatusMessage("⭕ Unlinked " + it.name)
-				case StatusConflict:
-					m.list.NewStatusMessage("⚠️ Conflict on " + it.name)
+				switch it.Status {
+				case link.StatusLinked:
+					m.list.NewStatusMessage("✅ Linked " + it.Rel)
+				case link.StatusMissing:
+					m.list.NewStatusMessage("⭕ Unlinked " + it.Rel)
+				case link.StatusConflict:
+					m.list.NewStatusMessage(conflictIcons[it.Conflict] + " " + conflictMessage(it.Entry))
 				}
 			}
 
-		case "a":
-			// Link ALL files in package
-			linked, skipped, errors := m.linkAll()
-			m.refreshAllStatuses()
-			if errors > 0 {
-				m.list.NewStatusMessage(fmt.Sprintf("✅ Linked %d, skipped %d, ⚠️ %d errors", linked, skipped, errors))
+		case "enter":
+			// Open the resolution dialog for a conflicted file
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			if it, ok := m.list.SelectedItem().(fileItem); ok && it.Source != "" && it.Status == link.StatusConflict {
+				m.conflict = &it
+				return m, nil
+			}
+
+		case "u":
+			// Undo the most recent operation from the journal
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.list.NewStatusMessage(historyMessage("Undo", m.engine.Undo))
+			m.reload() // an undone add takes files out of the package
+			return m, nil
+
+		case "ctrl+r":
+			// Redo the most recently undone operation
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.list.NewStatusMessage(historyMessage("Redo", m.engine.Redo))
+			m.reload()
+			return m, nil
+
+		case "p":
+			// Pull a modified copy (or secret) back into the package
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			it, ok := m.list.SelectedItem().(fileItem)
+			if !ok || it.Source == "" {
+				break
+			}
+			b, err := m.engine.Pull(it.Entry)
+			if err != nil {
+				m.list.NewStatusMessage("⚠️ " + err.Error())
 			} else {
-				m.list.NewStatusMessage(fmt.Sprintf("✅ Linked %d files, skipped %d", linked, skipped))
+				m.list.NewStatusMessage("⬅️ Pulled " + b.Target + " into the package, old version kept at " + b.Path + " (u: undo)")
 			}
+			m.refreshAll()
+			return m, nil
+
+		case "+":
+			// Ask for a file or directory to move into this package
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			m.adding = true
+			m.addInput.Width = m.width - 10
+			m.addInput.Focus()
+			return m, textinput.Blink
+
+		case "R":
+			// Link the selected file with a relative symlink, whatever the config says
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			it, ok := m.list.SelectedItem().(fileItem)
+			if !ok || it.Source == "" {
+				break
+			}
+			res := m.engine.LinkWith(it.Entry, true)
+			it.Entry = m.engine.Refresh(it.Entry)
+			m.list.SetItem(m.list.Index(), it)
+			switch {
+			case len(res.Errors) > 0:
+				m.list.NewStatusMessage("⚠️ " + errors.Join(res.Errors...).Error())
+			case res.Done == 0:
+				m.list.NewStatusMessage("Nothing changed: " + it.Rel + " is already linked")
+			default:
+				m.list.NewStatusMessage("✅ Linked " + it.Rel + " (relative)")
+			}
+			return m, nil
+
+		case "a":
+			// Plan linking ALL files in package and the packages it
+			// requires, then ask for confirmation
+			if m.list.FilterState() == list.Filtering {
+				break
+			}
+			plan, _, err := planLinkPackage(m.engine, filepath.Base(m.packagePath))
+			if err != nil {
+				m.list.NewStatusMessage("⚠️ " + err.Error())
+				return m, nil
+			}
+			m.pending, m.pendingVerb = &plan, "Link"
+			return m, nil
 
 		case "A":
-			// Unlink ALL files in package
-			unlinked, skipped, errors := m.unlinkAll()
-			m.refreshAllStatuses()
-			if errors > 0 {
-				m.list.NewStatusMessage(fmt.Sprintf("⭕ Unlinked %d, skipped %d, ⚠️ %d errors", unlinked, skipped, errors))
-			} else {
-				m.list.NewStatusMessage(fmt.Sprintf("⭕ Unlinked %d files, skipped %d", unlinked, skipped))
+			// Plan unlinking ALL files in package, then ask for confirmation
+			if m.list.FilterState() == list.Filtering {
+				break
 			}
+			entries, _ := m.entries()
+			plan := m.engine.PlanUnlink(entries)
+			m.pending, m.pendingVerb = &plan, "Unlink"
+			return m, nil
 		}
 	}
 
@@ -340,201 +435,201 @@ func (m fileListModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m fileListModel) View() string {
+	if m.adding {
+		prompt := lipgloss.NewStyle().Foreground(colorGit).Render(" add to " + filepath.Base(m.packagePath) + ": ")
+		return m.list.View() + "\n" + prompt + m.addInput.View()
+	}
+	if m.diff != nil {
+		title := lipgloss.NewStyle().Bold(true).Foreground(colorTitleFocus).
+			Render(" Diff: " + m.conflict.Target + " → " + m.conflict.Rel)
+		hint := lipgloss.NewStyle().Foreground(colorDim).Render(" ↑↓: scroll  esc: back")
+		return title + "\n\n" + m.diff.View() + "\n\n" + hint
+	}
+	if m.conflict != nil {
+		return renderConflict(m.conflict.Entry)
+	}
+	if m.pending != nil {
+		title := lipgloss.NewStyle().Bold(true).Foreground(colorTitleFocus).
+			Render(fmt.Sprintf(" %s plan for %s", m.pendingVerb, filepath.Base(m.packagePath)))
+		prompt := lipgloss.NewStyle().Foreground(colorHighlight).
+			Render(" " + planPrompt(m.pendingVerb, filepath.Base(m.packagePath), *m.pending))
+		return title + "\n\n" + renderPlan(*m.pending) + "\n\n" + prompt
+	}
 	return m.list.View()
 }
 
-// linkAll links all files that aren't already linked.
-// Returns (linked, skipped, errors) counts.
-func (m *fileListModel) linkAll() (int, int, int) {
-	linked, skipped, errors := 0, 0, 0
-	for i, item := range m.list.Items() {
-		it, ok := item.(fileItem)
-		if !ok {
-			continue
-		}
-		if it.status == StatusLinked {
-			skipped++
-			continue
-		}
-		src := filepath.Join(m.packagePath, it.name)
-		if err := linkDotfile(src, it.target); err != nil {
-			errors++
-		} else {
-			linked++
-		}
-		// Update item status
-		it.status = computeLinkStatus(src, it.target)
-		m.list.SetItem(i, it)
-	}
-	return linked, skipped, errors
+// capturing reports whether a dialog, the add prompt or the filter input is
+// open, so that every key belongs to them.
+func (m fileListModel) capturing() bool {
+	return m.pending != nil || m.conflict != nil || m.adding || m.list.FilterState() == list.Filtering
 }
 
-// unlinkAll unlinks all files that are currently linked.
-// Returns (unlinked, skipped, errors) counts.
-func (m *fileListModel) unlinkAll() (int, int, int) {
-	unlinked, skipped, errors := 0, 0, 0
-	for i, item := range m.list.Items() {
-		it, ok := item.(fileItem)
-		if !ok {
-			continue
-		}
-		if it.status != StatusLinked {
-			skipped++
-			continue
-		}
-		src := filepath.Join(m.packagePath, it.name)
-		if err := unlinkDotfile(src, it.target); err != nil {
-			errors++
-		} else {
-			unlinked++
-		}
-		// Update item status
-		it.status = computeLinkStatus(src, it.target)
-		m.list.SetItem(i, it)
-	}
-	return unlinked, skipped, errors
+// setSize resizes the list, e.g. to fit the dashboard pane it is shown in.
+func (m *fileListModel) setSize(width, height int) {
+	m.width, m.height = width, height
+	m.list.SetSize(width, height)
 }
 
-// refreshAllStatuses recomputes status for all items.
-func (m *fileListModel) refreshAllStatuses() {
+// entries returns the link entries behind the list items, along with
+// their list indices. Placeholder rows are skipped.
+func (m *fileListModel) entries() ([]link.Entry, []int) {
+	var entries []link.Entry
+	var idx []int
 	for i, item := range m.list.Items() {
 		it, ok := item.(fileItem)
-		if !ok {
+		if !ok || it.Source == "" {
 			continue
 		}
-		src := filepath.Join(m.packagePath, it.name)
-		it.status = computeLinkStatus(src, it.target)
-		m.list.SetItem(i, it)
+		entries = append(entries, it.Entry)
+		idx = append(idx, i)
 	}
+	return entries, idx
 }
 
-//
-// 🔹 Helpers
-//
-
-// computeLinkStatus checks what's at targetPath and whether it is a symlink
-// pointing back to srcPath (the file inside the package).
-func computeLinkStatus(srcPath, targetPath string) LinkStatus {
-	info, err := os.Lstat(targetPath)
-	if os.IsNotExist(err) {
-		return StatusMissing
-	}
-	if err != nil {
-		return StatusConflict
+// setEntries writes updated entries back to the list items at idx.
+func (m *fileListModel) setEntries(entries []link.Entry, idx []int) {
+	for i, e := range entries {
+		m.list.SetItem(idx[i], fileItem{e})
 	}
+}
 
-	// If it's a symlink, check where it points.
-	if info.Mode()&os.ModeSymlink != 0 {
-		linkDest, err := os.Readlink(targetPath)
-		if err != nil {
-			return StatusConflict
+// updateConflict handles keys while the conflict dialog is open.
+func (m fileListModel) updateConflict(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.diff != nil {
+		switch msg.String() {
+		case "esc", "q", "d":
+			m.diff = nil
+			return m, nil
 		}
+		var cmd tea.Cmd
+		vp, cmd := m.diff.Update(msg)
+		m.diff = &vp
+		return m, cmd
+	}
 
-		absSrc, _ := filepath.Abs(srcPath)
-		absDest := linkDest
+	key := msg.String()
+	switch key {
+	case "esc", "q", "n":
+		m.conflict = nil
+		m.list.NewStatusMessage("Cancelled")
+		return m, nil
 
-		// If the symlink is relative, resolve it relative to the directory it's in.
-		if !filepath.IsAbs(absDest) {
-			dir := filepath.Dir(targetPath)
-			absDest = filepath.Join(dir, absDest)
+	case "d":
+		if !conflictOffers(m.conflict.Entry, key) {
+			return m, nil
 		}
-		absDest, _ = filepath.Abs(absDest)
-
-		if absSrc == absDest {
-			return StatusLinked
+		out, err := conflictDiff(m.engine, m.conflict.Entry)
+		if err != nil {
+			m.list.NewStatusMessage("⚠️ " + err.Error())
+			return m, nil
 		}
-		return StatusConflict
+		vp := viewport.New(m.width, max(m.height-4, 1))
+		vp.SetContent(renderDiff(out))
+		m.diff = &vp
+		return m, nil
 	}
 
-	// Not a symlink – some other file/dir is in the way.
-	return StatusConflict
+	how, ok := conflictResolutions[key]
+	if !ok || !conflictOffers(m.conflict.Entry, key) {
+		return m, nil
+	}
+	b, err := m.engine.Resolve(m.conflict.Entry, how)
+	m.conflict = nil
+	if err != nil {
+		m.list.NewStatusMessage("⚠️ " + err.Error())
+	} else {
+		m.list.NewStatusMessage("✅ " + resolveMessage(b))
+	}
+	m.refreshAll()
+	return m, nil
 }
 
-// linkDotfile creates a symlink from srcPath (in the repo) to targetPath (in $HOME).
-// It will:
-//   - create parent directories if needed
-//   - skip if the correct symlink already exists
-//   - return an error if a conflicting file/symlink exists
-func linkDotfile(srcPath, targetPath string) error {
-	// Ensure parent directory exists
-	if err := os.MkdirAll(filepath.Dir(targetPath), 0o755); err != nil {
-		return fmt.Errorf("mkdir failed: %w", err)
-	}
-
-	info, err := os.Lstat(targetPath)
-	if err == nil {
-		// Something already exists at target
-		if info.Mode()&os.ModeSymlink != 0 {
-			// It's a symlink; check if it's already correct
-			linkDest, err := os.Readlink(targetPath)
-			if err != nil {
-				return fmt.Errorf("readlink failed: %w", err)
-			}
-
-			absSrc, _ := filepath.Abs(srcPath)
-			absDest := linkDest
-			if !filepath.IsAbs(absDest) {
-				absDest = filepath.Join(filepath.Dir(targetPath), absDest)
-			}
-			absDest, _ = filepath.Abs(absDest)
+// historyMessage runs an undo or redo step and describes the outcome for
+// the status line.
+func historyMessage(verb string, step func() (link.JournalEntry, error)) string {
+	op, err := step()
+	switch {
+	case errors.Is(err, link.ErrNothingToUndo), errors.Is(err, link.ErrNothingToRedo):
+		return err.Error()
+	case err != nil:
+		return "⚠️ " + verb + " failed: " + err.Error()
+	case verb == "Undo":
+		return "↩️ Undid " + op.String() + " (ctrl+r: redo)"
+	}
+	return "↪️ Redid " + op.String() + " (u: undo)"
+}
 
-			if absSrc == absDest {
-				// Already correctly linked
-				return nil
-			}
-			return fmt.Errorf("target already linked to a different path: %s", targetPath)
-		}
+// updateAdd handles keys while the add-path prompt is open.
+func (m fileListModel) updateAdd(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.adding = false
+		m.addInput.Reset()
+		m.addInput.Blur()
+		return m, nil
 
-		// Regular file or directory exists
-		return fmt.Errorf("target already exists and is not a symlink: %s", targetPath)
-	} else if !os.IsNotExist(err) {
-		// Some other filesystem error
-		return fmt.Errorf("lstat failed: %w", err)
-	}
+	case "enter":
+		input := m.addInput.Value()
+		m.adding = false
+		m.addInput.Reset()
+		m.addInput.Blur()
 
-	// Safe to create the symlink
-	if err := os.Symlink(srcPath, targetPath); err != nil {
-		return fmt.Errorf("symlink failed: %w", err)
+		path, err := fs.ResolvePath(input)
+		if err != nil {
+			m.list.NewStatusMessage("⚠️ " + err.Error())
+			return m, nil
+		}
+		added, err := m.engine.Add(m.packagePath, path)
+		if err != nil {
+			m.list.NewStatusMessage("⚠️ " + err.Error())
+			return m, nil
+		}
+		m.reload()
+		m.list.NewStatusMessage(fmt.Sprintf("✅ Added %d files from %s", len(added), path))
+		return m, nil
 	}
 
-	return nil
+	var cmd tea.Cmd
+	m.addInput, cmd = m.addInput.Update(msg)
+	return m, cmd
 }
 
-// unlinkDotfile removes a symlink at targetPath IF and only if it points to srcPath.
-// It won't touch regular files or symlinks pointing elsewhere.
-func unlinkDotfile(srcPath, targetPath string) error {
-	info, err := os.Lstat(targetPath)
-	if os.IsNotExist(err) {
-		// Nothing to do
-		return nil
-	}
+// reload rescans the package, e.g. after files were added to it.
+func (m *fileListModel) reload() {
+	entries, err := m.engine.Scan(m.packagePath)
 	if err != nil {
-		return fmt.Errorf("lstat failed: %w", err)
+		m.list.NewStatusMessage("⚠️ " + err.Error())
+		return
 	}
-
-	if info.Mode()&os.ModeSymlink == 0 {
-		return fmt.Errorf("target is not a symlink: %s", targetPath)
+	items := make([]list.Item, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, fileItem{e})
 	}
+	m.list.SetItems(items)
+}
 
-	linkDest, err := os.Readlink(targetPath)
-	if err != nil {
-		return fmt.Errorf("readlink failed: %w", err)
+// refreshAll recomputes the status of every item.
+func (m *fileListModel) refreshAll() {
+	entries, idx := m.entries()
+	for i := range entries {
+		entries[i] = m.engine.Refresh(entries[i])
 	}
+	m.setEntries(entries, idx)
+}
 
-	absSrc, _ := filepath.Abs(srcPath)
-	absDest := linkDest
-	if !filepath.IsAbs(absDest) {
-		absDest = filepath.Join(filepath.Dir(targetPath), absDest)
-	}
-	absDest, _ = filepath.Abs(absDest)
+// applyPending applies the confirmed batch plan and refreshes every item.
+func (m *fileListModel) applyPending() {
+	res := m.engine.Apply(*m.pending)
+	verb := m.pendingVerb
+	m.pending = nil
+	m.refreshAll()
 
-	if absSrc != absDest {
-		return fmt.Errorf("symlink points elsewhere, refusing to remove: %s", targetPath)
+	icon := "✅"
+	if verb == "Unlink" {
+		icon = "⭕"
 	}
-
-	if err := os.Remove(targetPath); err != nil {
-		return fmt.Errorf("remove failed: %w", err)
+	if len(res.Errors) > 0 {
+		icon = "⚠️"
 	}
-
-	return nil
+	m.list.NewStatusMessage(icon + " " + resultMessage(verb, res))
 }
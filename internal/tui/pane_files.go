@@ -0,0 +1,67 @@
+package tui
+
+import (
+	"github.com/anakafeel/LazyDots/internal/config"
+	"github.com/anakafeel/LazyDots/internal/link"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// filesPane takes the place of the detail pane when a package is entered,
+// with the same per-file toggling, conflict resolution, batch link/unlink
+// and filtering as the full-screen file list.
+type filesPane struct {
+	width, height int
+	focused       bool
+	name          string
+	files         fileListModel
+}
+
+func newFilesPane(cfg config.Config, engine *link.Engine, name, pkgPath string) *filesPane {
+	files := newFileList(cfg, engine, pkgPath, "", 0, 0)
+	files.list.Title = "Files"
+	files.list.SetShowHelp(false)
+	return &filesPane{name: name, files: files}
+}
+
+func (p *filesPane) Update(msg tea.Msg) tea.Cmd {
+	if !p.focused {
+		return nil
+	}
+	next, cmd := p.files.Update(msg)
+	if files, ok := next.(fileListModel); ok {
+		p.files = files
+	}
+	return cmd
+}
+
+// Capturing reports whether every key belongs to the pane, e.g. while a
+// conflict dialog is open or a filter is being typed.
+func (p *filesPane) Capturing() bool { return p.files.capturing() }
+
+// Back handles esc (or q) when nothing is capturing keys: an applied
+// filter is cleared first. It reports whether the pane should be closed.
+func (p *filesPane) Back() bool {
+	if p.files.list.FilterState() == list.FilterApplied {
+		p.files.list.ResetFilter()
+		return false
+	}
+	return true
+}
+
+// Reload rescans the package, e.g. after an undo from another pane.
+func (p *filesPane) Reload() { p.files.reload() }
+
+func (p *filesPane) View() string {
+	return renderPane(p.Title(), p.files.View(), p.width, p.height, p.focused)
+}
+
+func (p *filesPane) SetSize(w, h int) {
+	p.width, p.height = w, h
+	p.files.setSize(max(w-2, 1), max(h-2, 1))
+}
+
+func (p *filesPane) Focus()        { p.focused = true }
+func (p *filesPane) Blur()         { p.focused = false }
+func (p *filesPane) Focused() bool { return p.focused }
+func (p *filesPane) Title() string { return "5 " + p.name }
@@ -2,17 +2,18 @@ package tui
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
+	"github.com/anakafeel/LazyDots/internal/link"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 )
 
 type pkgEntry struct {
-	name string
-	path string
+	name     string
+	path     string
+	overlaps []string // packages claiming some of the same targets
+	manifest link.Manifest
 }
 
 type packagesPane struct {
@@ -23,19 +24,13 @@ type packagesPane struct {
 	offset        int
 }
 
-func newPackagesPane(rootPath string) *packagesPane {
+func newPackagesPane(rootPath string, owners link.Owners) *packagesPane {
 	var items []pkgEntry
-	entries, err := os.ReadDir(rootPath)
-	if err == nil {
-		for _, e := range entries {
-			if !e.IsDir() || e.Name() == ".git" {
-				continue
-			}
-			items = append(items, pkgEntry{
-				name: e.Name(),
-				path: filepath.Join(rootPath, e.Name()),
-			})
-		}
+	pkgs, _ := link.Packages(rootPath)
+	overlaps := owners.Overlaps()
+	for _, pkg := range pkgs {
+		manifest, _ := link.ReadManifest(pkg.Path)
+		items = append(items, pkgEntry{name: pkg.Name, path: pkg.Path, overlaps: overlaps[pkg.Name], manifest: manifest})
 	}
 	return &packagesPane{items: items}
 }
@@ -92,6 +87,8 @@ func (p *packagesPane) View() string {
 		Background(colorCursorBg).
 		Bold(true)
 	normalStyle := lipgloss.NewStyle().Foreground(colorNormal)
+	warnStyle := lipgloss.NewStyle().Foreground(colorWarn)
+	dimStyle := lipgloss.NewStyle().Foreground(colorDim)
 
 	ih := p.innerHeight()
 	innerW := p.width - 2
@@ -99,17 +96,56 @@ func (p *packagesPane) View() string {
 	var lines []string
 	for i := p.offset; i < len(p.items) && i < p.offset+ih; i++ {
 		label := " " + p.items[i].name
-		if i == p.cursor && p.focused {
+		overlap := len(p.items[i].overlaps) > 0
+		if overlap {
+			label += " !"
+		}
+		switch {
+		case i == p.cursor && p.focused:
 			label = cursorStyle.Render(padOrTruncate(label, innerW))
-		} else {
+		case overlap:
+			label = warnStyle.Render(label)
+		default:
 			label = normalStyle.Render(label)
 		}
+		if desc := p.items[i].manifest.Description; desc != "" && (i != p.cursor || !p.focused) {
+			label += dimStyle.Render(" " + desc)
+		}
 		lines = append(lines, label)
 	}
 
 	return renderPane(p.Title(), strings.Join(lines, "\n"), p.width, p.height, p.focused)
 }
 
+// renderManifest formats the manifest of the package at pkgPath for the
+// detail pane, or returns "" if it has none.
+func renderManifest(pkgPath string) string {
+	dim := lipgloss.NewStyle().Foreground(colorDim)
+	normal := lipgloss.NewStyle().Foreground(colorNormal)
+	m, err := link.ReadManifest(pkgPath)
+	if err != nil {
+		return " " + lipgloss.NewStyle().Foreground(colorWarn).Render(err.Error())
+	}
+
+	var lines []string
+	if m.Description != "" {
+		lines = append(lines, " "+normal.Render(m.Description))
+	}
+	for _, field := range []struct {
+		name   string
+		values []string
+	}{
+		{"Requires:", m.Requires},
+		{"Conflicts:", m.Conflicts},
+		{"OS:", m.OS},
+	} {
+		if len(field.values) > 0 {
+			lines = append(lines, " "+dim.Render(field.name)+" "+normal.Render(strings.Join(field.values, ", ")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
 func (p *packagesPane) Selected() *pkgEntry {
 	if len(p.items) == 0 || p.cursor >= len(p.items) {
 		return nil
@@ -14,13 +14,15 @@ type statusPane struct {
 	gitStatus     git.RepoStatus
 	repoName      string
 	repoPath      string
+	profile       string // active profile, or "" if none applies
 }
 
-func newStatusPane(repoName, repoPath string, gs git.RepoStatus) *statusPane {
+func newStatusPane(repoName, repoPath string, gs git.RepoStatus, profile string) *statusPane {
 	return &statusPane{
 		repoName:  repoName,
 		repoPath:  repoPath,
 		gitStatus: gs,
+		profile:   profile,
 	}
 }
 
@@ -31,12 +33,18 @@ func (p *statusPane) View() string {
 	dim := lipgloss.NewStyle().Foreground(colorDim)
 	normal := lipgloss.NewStyle().Foreground(colorNormal)
 
+	profile := dim.Render("none")
+	if p.profile != "" {
+		profile = normal.Render(p.profile)
+	}
 	content := fmt.Sprintf(
-		" %s %s\n %s %s",
+		" %s %s\n %s %s\n %s %s",
 		normal.Render(p.repoName),
 		gs.Render(p.gitStatus.FormatStatus()),
 		dim.Render("Path:"),
 		normal.Render(p.repoPath),
+		dim.Render("Profile:"),
+		profile,
 	)
 
 	return renderPane(p.Title(), content, p.width, p.height, p.focused)
@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/anakafeel/LazyDots/internal/link"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// renderPlan formats a link plan for the detail pane, one action per line.
+func renderPlan(plan link.Plan) string {
+	dim := lipgloss.NewStyle().Foreground(colorDim)
+	add := lipgloss.NewStyle().Foreground(colorLinked)
+	remove := lipgloss.NewStyle().Foreground(colorHighlight)
+	skip := lipgloss.NewStyle().Foreground(colorWarn)
+
+	var lines []string
+	for _, a := range plan.Actions {
+		var line string
+		switch a.Kind {
+		case link.ActionMkdir:
+			line = dim.Render("mkdir   ") + " " + a.Path
+		case link.ActionSymlink:
+			line = add.Render("symlink ") + " " + a.Path + dim.Render(" → "+a.Source)
+		case link.ActionRender:
+			line = add.Render("write   ") + " " + a.Path + dim.Render(" ← "+a.Source)
+		case link.ActionRemove:
+			line = remove.Render("remove  ") + " " + a.Path
+		case link.ActionSkip:
+			line = skip.Render("skip    ") + " " + a.Path + dim.Render(" ("+a.Reason+")")
+		}
+		lines = append(lines, " "+line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, " "+dim.Render("Nothing to do"))
+	}
+
+	lines = append(lines, "", " "+dim.Render(fmt.Sprintf(
+		"%d changes, %d conflicts, %d unchanged",
+		plan.Changes(), plan.Conflicts(), plan.Unchanged,
+	)))
+	return strings.Join(lines, "\n")
+}
+
+// planLinkPackage plans linking the package name together with the
+// packages it requires. It returns the plan and a label naming the package
+// and its requirements, e.g. "nvim (+git, shell)".
+func planLinkPackage(engine *link.Engine, name string) (link.Plan, string, error) {
+	pkgs, err := engine.PackagesToLink([]string{name})
+	if err != nil {
+		return link.Plan{}, "", err
+	}
+	var entries []link.Entry
+	var extra []string
+	for _, pkg := range pkgs {
+		pe, err := engine.Scan(pkg.Path)
+		if err != nil {
+			return link.Plan{}, "", err
+		}
+		entries = append(entries, pe...)
+		if pkg.Name != name {
+			extra = append(extra, pkg.Name)
+		}
+	}
+	label := name
+	if len(extra) > 0 {
+		label += " (+" + strings.Join(extra, ", ") + ")"
+	}
+	return engine.PlanLink(entries), label, nil
+}
+
+// planPrompt is the confirmation question shown under a pending plan.
+func planPrompt(verb, pkg string, plan link.Plan) string {
+	if n := plan.Conflicts(); n > 0 {
+		return fmt.Sprintf("%s plan for %s has %d conflicts; nothing will change (esc)", verb, pkg, n)
+	}
+	return fmt.Sprintf("%s plan for %s: apply? (y/n)", verb, pkg)
+}
+
+// resultMessage summarises an applied plan for the footer.
+func resultMessage(verb string, res link.Result) string {
+	switch {
+	case res.RolledBack:
+		return fmt.Sprintf("%s failed and was rolled back: %v", verb, res.Errors[0])
+	case len(res.Errors) > 0:
+		return fmt.Sprintf("%s refused, %d conflicts: %v", verb, len(res.Errors), res.Errors[0])
+	}
+	return fmt.Sprintf("%sed %d files, skipped %d", verb, res.Done, res.Skipped)
+}
@@ -15,7 +15,6 @@ import (
 type setupModel struct {
 	input textinput.Model
 	msg   string
-	done  bool
 	err   error
 }
 
@@ -88,8 +87,8 @@ func (m setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
-			m.done = true
-			return m, tea.Quit
+			// Offer to import existing config into the new repository
+			return NewDiscoverModel(cfg), tea.WindowSize()
 
 		case "ctrl+c", "esc":
 			return m, tea.Quit
@@ -102,10 +101,6 @@ func (m setupModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m setupModel) View() string {
-	if m.done {
-		return "✅ Config saved! Restart LazyDots.\n"
-	}
-
 	return fmt.Sprintf(
 		"🧩 Welcome to LazyDots!\n\nEnter the full path to your dotfiles directory:\n\n%s\n\n%s\n\n(press Enter to save, Esc to quit)",
 		m.input.View(),
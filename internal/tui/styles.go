@@ -13,4 +13,6 @@ var (
 	colorGit         = lipgloss.Color("39")
 	colorCursorFg    = lipgloss.Color("0")
 	colorCursorBg    = lipgloss.Color("63")
+	colorLinked      = lipgloss.Color("42")
+	colorWarn        = lipgloss.Color("214")
 )